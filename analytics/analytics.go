@@ -0,0 +1,153 @@
+// Package analytics computes the key figures of a solar installation:
+// self-consumption ratio, autarky (self-sufficiency) and grid import and
+// export, both from live pie chart data and from consumption statistics.
+package analytics
+
+import (
+	"strings"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// KPIs are the energy flows of an installation, either in power at an
+// instant (Watt) or in energy over a period (WattHour).
+type KPIs[T solarmanager.Watt | solarmanager.WattHour] struct {
+	Production  T
+	Consumption T
+	GridImport  T
+	GridExport  T
+	// BatteryCharge and BatteryDischarge are only known for live data.
+	BatteryCharge    T
+	BatteryDischarge T
+}
+
+// SelfConsumed returns the part of the production that wasn't fed into
+// the grid, i.e. consumed on site or stored in the battery.
+func (k KPIs[T]) SelfConsumed() T {
+	return max(k.Production-k.GridExport, 0)
+}
+
+// SelfSupplied returns the part of the consumption that wasn't drawn from
+// the grid.
+func (k KPIs[T]) SelfSupplied() T {
+	return max(k.Consumption-k.GridImport, 0)
+}
+
+// SelfConsumptionRatio returns the fraction of the production consumed on
+// site, between 0 and 1. It is 0 if there is no production.
+func (k KPIs[T]) SelfConsumptionRatio() float64 {
+	return ratio(k.SelfConsumed(), k.Production)
+}
+
+// Autarky returns the fraction of the consumption covered without the
+// grid, between 0 and 1. It is 0 if there is no consumption.
+func (k KPIs[T]) Autarky() float64 {
+	return ratio(k.SelfSupplied(), k.Consumption)
+}
+
+// Add returns the sum of k and l.
+func (k KPIs[T]) Add(l KPIs[T]) KPIs[T] {
+	return KPIs[T]{
+		Production:       k.Production + l.Production,
+		Consumption:      k.Consumption + l.Consumption,
+		GridImport:       k.GridImport + l.GridImport,
+		GridExport:       k.GridExport + l.GridExport,
+		BatteryCharge:    k.BatteryCharge + l.BatteryCharge,
+		BatteryDischarge: k.BatteryDischarge + l.BatteryDischarge,
+	}
+}
+
+func ratio[T solarmanager.Watt | solarmanager.WattHour](part, total T) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return min(float64(part)/float64(total), 1)
+}
+
+// FromPieChart returns the live KPIs of a gateway. The flows are taken from
+// the arrows of the chart. Without arrows, they are derived from the
+// balance of production, consumption and battery power.
+func FromPieChart(chart solarmanager.GetGatewayPieChartResponse) KPIs[solarmanager.Watt] {
+	k := KPIs[solarmanager.Watt]{
+		Production:  chart.Production,
+		Consumption: chart.Consumption,
+	}
+	if len(chart.Arrows) == 0 {
+		k.BatteryCharge = chart.Battery.BatteryCharging
+		k.BatteryDischarge = chart.Battery.BatteryDischarging
+		net := k.Production + k.BatteryDischarge - k.Consumption - k.BatteryCharge
+		k.GridExport = max(net, 0)
+		k.GridImport = max(-net, 0)
+		return k
+	}
+	for _, a := range chart.Arrows {
+		switch {
+		case strings.HasPrefix(a.Direction, "fromGrid"):
+			k.GridImport += a.Value
+		case strings.HasSuffix(a.Direction, "ToGrid"):
+			k.GridExport += a.Value
+		}
+		switch {
+		case strings.HasPrefix(a.Direction, "fromBattery"):
+			k.BatteryDischarge += a.Value
+		case strings.HasSuffix(a.Direction, "ToBattery"):
+			k.BatteryCharge += a.Value
+		}
+	}
+	return k
+}
+
+// Bucket holds the KPIs of an entry of a statistics series.
+type Bucket struct {
+	CreatedAt string
+	KPIs[solarmanager.WattHour]
+}
+
+// Statistics holds the KPIs of a statistics series.
+type Statistics struct {
+	Period  string
+	Buckets []Bucket
+	Total   KPIs[solarmanager.WattHour]
+}
+
+// FromStatistics returns the KPIs of the gateway consumption statistics of
+// a day, month or year.
+//
+// The statistics only contain production and consumption, so the grid
+// flows of every bucket are estimated from their difference: a surplus is
+// assumed to be exported and a deficit imported. This ignores batteries and
+// flows within a bucket, so finer periods give more accurate results and
+// the self-consumption ratio and autarky are upper bounds.
+func FromStatistics(stats solarmanager.GetGatewayConsumptionStatisticsResponse) Statistics {
+	s := Statistics{Period: stats.Period}
+	for _, d := range stats.Data {
+		k := KPIs[solarmanager.WattHour]{
+			Production:  d.Production,
+			Consumption: d.Consumption,
+			GridExport:  max(d.Production-d.Consumption, 0),
+			GridImport:  max(d.Consumption-d.Production, 0),
+		}
+		s.Buckets = append(s.Buckets, Bucket{CreatedAt: d.CreatedAt, KPIs: k})
+		s.Total = s.Total.Add(k)
+	}
+	return s
+}
+
+// Live fetches the pie chart of a gateway and returns its KPIs.
+func Live(api solarmanager.API, smID string) (KPIs[solarmanager.Watt], error) {
+	chart, err := api.GetGatewayPieChart(smID)
+	if err != nil {
+		return KPIs[solarmanager.Watt]{}, err
+	}
+	return FromPieChart(chart), nil
+}
+
+// ForPeriod fetches the consumption statistics of a gateway and returns
+// their KPIs.
+func ForPeriod(api solarmanager.API, smID string, period solarmanager.StatisticPeriod) (Statistics, error) {
+	stats, err := api.GetGatewayConsumptionStatistics(smID, period)
+	if err != nil {
+		return Statistics{}, err
+	}
+	return FromStatistics(stats), nil
+}
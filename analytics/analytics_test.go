@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+	"github.com/ingmarstein/solarmanager-go/solarmanagertest"
+)
+
+func TestFromPieChart(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "gateway_pie_chart.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chart solarmanager.GetGatewayPieChartResponse
+	if err := json.Unmarshal(data, &chart); err != nil {
+		t.Fatal(err)
+	}
+
+	k := FromPieChart(chart)
+	expected := KPIs[solarmanager.Watt]{Production: 20000, Consumption: 5000, GridExport: 15000}
+	if k != expected {
+		t.Fatalf("unexpected KPIs %+v", k)
+	}
+	if r := k.SelfConsumptionRatio(); r != 0.25 {
+		t.Fatalf("unexpected self-consumption ratio %v", r)
+	}
+	if a := k.Autarky(); a != 1 {
+		t.Fatalf("unexpected autarky %v", a)
+	}
+
+	// Without arrows, the flows are derived from the balance.
+	chart.Arrows = nil
+	chart.Production, chart.Consumption = 2000, 5000
+	chart.Battery.BatteryDischarging = 1000
+	k = FromPieChart(chart)
+	expected = KPIs[solarmanager.Watt]{Production: 2000, Consumption: 5000, GridImport: 2000, BatteryDischarge: 1000}
+	if k != expected {
+		t.Fatalf("unexpected KPIs %+v", k)
+	}
+	if r, a := k.SelfConsumptionRatio(), k.Autarky(); r != 1 || a != 0.6 {
+		t.Fatalf("unexpected self-consumption ratio %v and autarky %v", r, a)
+	}
+
+	// Ratios are 0 without production or consumption.
+	if k := (KPIs[solarmanager.Watt]{}); k.SelfConsumptionRatio() != 0 || k.Autarky() != 0 {
+		t.Fatal("expected zero ratios")
+	}
+}
+
+func TestFromStatistics(t *testing.T) {
+	var stats solarmanager.GetGatewayConsumptionStatisticsResponse
+	err := json.Unmarshal([]byte(`{
+		"gatewayId": "sm1",
+		"period": "month",
+		"data": [
+			{"createdAt": "2021-04-01", "consumption": 10000, "production": 30000},
+			{"createdAt": "2021-04-02", "consumption": 12000, "production": 4000},
+			{"createdAt": "2021-04-03", "consumption": 8000, "production": 8000}
+		]
+	}`), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &solarmanagertest.Fake{
+		GetGatewayConsumptionStatisticsFunc: func(smID string, period solarmanager.StatisticPeriod) (solarmanager.GetGatewayConsumptionStatisticsResponse, error) {
+			return stats, nil
+		},
+	}
+
+	s, err := ForPeriod(fake, "sm1", solarmanager.Month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Period != "month" || len(s.Buckets) != 3 {
+		t.Fatalf("unexpected statistics %+v", s)
+	}
+	if b := s.Buckets[1]; b.CreatedAt != "2021-04-02" || b.GridImport != 8000 || b.GridExport != 0 {
+		t.Fatalf("unexpected bucket %+v", b)
+	}
+	expected := KPIs[solarmanager.WattHour]{Production: 42000, Consumption: 30000, GridImport: 8000, GridExport: 20000}
+	if !reflect.DeepEqual(s.Total, expected) {
+		t.Fatalf("unexpected total %+v", s.Total)
+	}
+	if r := s.Total.SelfConsumptionRatio(); math.Abs(r-22000.0/42000) > 1e-9 {
+		t.Fatalf("unexpected self-consumption ratio %v", r)
+	}
+	if a := s.Total.Autarky(); math.Abs(a-22000.0/30000) > 1e-9 {
+		t.Fatalf("unexpected autarky %v", a)
+	}
+}
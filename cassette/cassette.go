@@ -0,0 +1,394 @@
+// Package cassette records SolarManager API responses into cassette files and
+// replays them offline. Both Recorder and Replayer are http.RoundTrippers and
+// can be plugged into solarmanager.NewClient via its httpClient parameter:
+//
+//	rec := cassette.NewRecorder(nil, map[string]string{smID: "sm-test"})
+//	client := solarmanager.NewClient(&http.Client{Transport: rec}, nil, username, password)
+//	// ... make requests ...
+//	err := rec.Save("testdata/installation.json")
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"` // path and query, without scheme and host
+	Status int             `json:"status"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// BodyText holds the body if it is not valid JSON, e.g. for errors
+	// returned by proxies.
+	BodyText string `json:"bodyText,omitempty"`
+}
+
+// Cassette is a list of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Load reads a cassette from a file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("cassette: %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to a file.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Placeholders used for redacted values.
+const (
+	RedactedText = "REDACTED"
+	RedactedMAC  = "00:00:00:00:00:00" // other MAC formats are zeroed alike
+	RedactedIP   = "192.0.2.1"         // TEST-NET-1, see RFC 5737
+)
+
+// sensitiveHeaders are dropped from recorded responses.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "WWW-Authenticate"}
+
+// piiKeys are JSON keys whose values identify the owner of an installation,
+// most notably those of GetGatewayInfoResponse.User.
+var piiKeys = map[string]bool{
+	"first_name":   true,
+	"last_name":    true,
+	"email":        true,
+	"user_id":      true,
+	"owner":        true,
+	"city":         true,
+	"zip":          true,
+	"street":       true,
+	"phone":        true,
+	"plant":        true,
+	"company_name": true,
+	"company":      true,
+}
+
+// smIDEndpoints are the API paths followed by a SolarManager ID.
+var smIDEndpoints = []string{
+	"/v1/info/gateway/",
+	"/v1/info/sensors/",
+	"/v1/stream/gateway/",
+	"/v1/stream/sensor/",
+	"/v1/consumption/gateway/",
+	"/v1/chart/gateway/",
+	"/v1/forecast/gateways/",
+	"/v1/low-rate-tariff/gateways/",
+}
+
+var (
+	// macPattern matches MAC addresses separated by colons or hyphens, and
+	// bare ones.
+	macPattern = regexp.MustCompile(`(?i)\b([0-9a-f]{2}([:-][0-9a-f]{2}){5}|[0-9a-f]{12})\b`)
+	hexDigit   = regexp.MustCompile(`[0-9a-fA-F]`)
+	ipPattern  = regexp.MustCompile(`\b(25[0-5]|2[0-4]\d|1?\d?\d)(\.(25[0-5]|2[0-4]\d|1?\d?\d)){3}\b`)
+)
+
+// Recorder is an http.RoundTripper that passes requests to an underlying
+// transport and records the responses. Sensitive data is redacted when the
+// cassette is saved. It is safe for concurrent use.
+type Recorder struct {
+	transport    http.RoundTripper
+	replacements map[string]string
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// NewRecorder returns a Recorder using transport, or http.DefaultTransport if
+// nil. Every occurrence of a key of replacements, e.g. a SolarManager ID, is
+// replaced by its value in the saved cassette. SolarManager IDs found in
+// sm_id fields and in the paths of the API endpoints are replaced
+// automatically.
+func NewRecorder(transport http.RoundTripper, replacements map[string]string) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := make(map[string]string, len(replacements))
+	for k, v := range replacements {
+		r[k] = v
+	}
+	return &Recorder{transport: transport, replacements: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	for _, h := range sensitiveHeaders {
+		header.Del(h)
+	}
+	// The length changes when the body is redacted.
+	header.Del("Content-Length")
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Method: req.Method,
+		URL:    req.URL.RequestURI(),
+		Status: resp.StatusCode,
+		Header: header,
+		Body:   body,
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Cassette returns the redacted recorded interactions.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	replacements := make(map[string]string, len(r.replacements))
+	for k, v := range r.replacements {
+		replacements[k] = v
+	}
+	n := len(replacements)
+	add := func(id, escaped string) {
+		if id == "" {
+			return
+		}
+		placeholder, ok := replacements[id]
+		if !ok {
+			n++
+			placeholder = fmt.Sprintf("sm-%d", n)
+			replacements[id] = placeholder
+		}
+		if _, ok := replacements[escaped]; !ok && escaped != "" {
+			replacements[escaped] = placeholder
+		}
+	}
+	// Collect SolarManager IDs first, so that they are also replaced in the
+	// URLs of requests made before the ID was seen in a response.
+	for _, in := range r.interactions {
+		for _, id := range findStrings(in.Body, "sm_id") {
+			add(id, url.PathEscape(id))
+		}
+		if escaped := pathSmID(in.URL); escaped != "" {
+			if id, err := url.PathUnescape(escaped); err == nil {
+				add(id, escaped)
+			}
+		}
+	}
+	// Replace longer values first, in case one contains another.
+	keys := make([]string, 0, len(replacements))
+	for k := range replacements {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	oldnew := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		oldnew = append(oldnew, k, replacements[k])
+	}
+	replacer := strings.NewReplacer(oldnew...)
+
+	c := &Cassette{Interactions: make([]Interaction, 0, len(r.interactions))}
+	for _, in := range r.interactions {
+		in.URL = replacer.Replace(in.URL)
+		if body, err := redact(in.Body, replacer); err == nil {
+			in.Body = body
+		} else {
+			in.BodyText = redactString("", string(in.Body), replacer)
+			in.Body = nil
+		}
+		c.Interactions = append(c.Interactions, in)
+	}
+	return c
+}
+
+// Save writes the redacted recorded interactions to a file.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// pathSmID returns the escaped SolarManager ID in the path of uri, or "" if
+// uri isn't of an endpoint in smIDEndpoints.
+func pathSmID(uri string) string {
+	path, _, _ := strings.Cut(uri, "?")
+	for _, prefix := range smIDEndpoints {
+		if i := strings.Index(path, prefix); i >= 0 {
+			id, _, _ := strings.Cut(path[i+len(prefix):], "/")
+			return id
+		}
+	}
+	return ""
+}
+
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// findStrings returns all string values of the given key in a JSON document.
+func findStrings(data []byte, key string) []string {
+	v, err := decode(data)
+	if err != nil {
+		return nil
+	}
+	var found []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				if s, ok := e.(string); ok && k == key {
+					found = append(found, s)
+				}
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+	return found
+}
+
+// redact removes personal data, MAC and IP addresses from a JSON body and
+// applies the replacer to all remaining strings.
+func redact(data []byte, replacer *strings.Replacer) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	v, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	var walk func(key string, v interface{}) interface{}
+	walk = func(key string, v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				v[k] = walk(k, e)
+			}
+			return v
+		case []interface{}:
+			for i, e := range v {
+				v[i] = walk(key, e)
+			}
+			return v
+		case string:
+			return redactString(key, v, replacer)
+		default:
+			return v
+		}
+	}
+	return json.Marshal(walk("", v))
+}
+
+func redactString(key, v string, replacer *strings.Replacer) string {
+	if piiKeys[key] && v != "" {
+		return RedactedText
+	}
+	// Replace SolarManager IDs first, as they may look like bare MACs.
+	v = replacer.Replace(v)
+	v = macPattern.ReplaceAllStringFunc(v, func(mac string) string {
+		return hexDigit.ReplaceAllString(mac, "0")
+	})
+	return ipPattern.ReplaceAllString(v, RedactedIP)
+}
+
+// ErrNoInteraction is returned by Replayer if a request was not recorded.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+// Replayer is an http.RoundTripper serving recorded interactions without
+// network access. Requests are matched by method, path and query. If the same
+// request was recorded multiple times, the responses are returned in recorded
+// order, repeating the last one. It is safe for concurrent use.
+type Replayer struct {
+	cassette *Cassette
+
+	mu   sync.Mutex
+	used []bool
+}
+
+// NewReplayer returns a Replayer serving the interactions of c.
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{cassette: c, used: make([]bool, len(c.Interactions))}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	uri := req.URL.RequestURI()
+
+	r.mu.Lock()
+	match := -1
+	for i, in := range r.cassette.Interactions {
+		if in.Method != req.Method || in.URL != uri {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match >= 0 {
+		r.used[match] = true
+	}
+	r.mu.Unlock()
+
+	if match < 0 {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoInteraction, req.Method, uri)
+	}
+	in := r.cassette.Interactions[match]
+	header := in.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	body := []byte(in.Body)
+	if in.BodyText != "" {
+		body = []byte(in.BodyText)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package cassette
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+	"github.com/ingmarstein/solarmanager-go/solarmanagertest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	svr := solarmanagertest.NewServer("user", "secret")
+	defer svr.Close()
+	g := solarmanagertest.NewGateway("A1B2C3D4")
+	g.Info.User.FirstName = "Max"
+	g.Info.User.Email = "max@example.com"
+	g.Info.User.Country = "Switzerland"
+	svr.AddGateway(g)
+
+	rec := NewRecorder(nil, nil)
+	live := solarmanager.NewClient(&http.Client{Transport: rec}, svr.BaseURL(), "user", "secret")
+	// The sensors are requested before the gateway info revealing the sm_id,
+	// the ID must nevertheless be redacted from the URL.
+	if _, err := live.GetSensors("A1B2C3D4"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := live.GetGatewayInfo("A1B2C3D4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User.FirstName != "Max" {
+		t.Fatal("recorder must not modify live responses")
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range c.Interactions {
+		s := in.URL + string(in.Body)
+		for _, secret := range []string{"A1B2C3D4", "Max", "max@example.com", "192.168.1.51", "2C:3E:51:00:00:00"} {
+			if strings.Contains(s, secret) {
+				t.Errorf("cassette contains %q: %s", secret, s)
+			}
+		}
+		if in.Header.Get("Authorization") != "" || in.Header.Get("WWW-Authenticate") != "" {
+			t.Errorf("cassette contains credentials headers")
+		}
+	}
+
+	offline := solarmanager.NewClient(&http.Client{Transport: NewReplayer(c)}, svr.BaseURL(), "", "")
+	svr.Close()
+	replayed, err := offline.GetGatewayInfo("sm-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Gateway.SmId != "sm-1" || replayed.Gateway.Ip != RedactedIP || replayed.Gateway.Mac != RedactedMAC {
+		t.Fatalf("unexpected replayed gateway %+v", replayed.Gateway)
+	}
+	if replayed.User.FirstName != RedactedText || replayed.User.Country != "Switzerland" {
+		t.Fatalf("unexpected replayed user %+v", replayed.User)
+	}
+	sensors, err := offline.GetSensors("sm-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 2 || sensors[0].Id != "sm-1-heater" {
+		t.Fatalf("unexpected replayed sensors %+v", sensors)
+	}
+
+	if _, err := offline.GetLowRateTariff("sm-1"); !errors.Is(err, ErrNoInteraction) {
+		t.Fatalf("unexpected error for unrecorded request: %v", err)
+	}
+}
+
+func TestRedactPathSmID(t *testing.T) {
+	svr := solarmanagertest.NewServer("user", "secret")
+	defer svr.Close()
+	svr.AddGateway(solarmanagertest.NewGateway("E5 F6"))
+
+	rec := NewRecorder(nil, nil)
+	live := solarmanager.NewClient(&http.Client{Transport: rec}, svr.BaseURL(), "user", "secret")
+	// No response contains the sm_id of the gateway.
+	if _, err := live.GetGatewayData("E5 F6"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.GetGatewayPieChart("E5 F6"); err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range rec.Cassette().Interactions {
+		if strings.Contains(in.URL, "E5") || !strings.Contains(in.URL, "/sm-1") {
+			t.Errorf("SolarManager ID not redacted from %s", in.URL)
+		}
+	}
+}
+
+func TestRedactMAC(t *testing.T) {
+	replacer := strings.NewReplacer("a1b2c3d4e5f6", "sm-1")
+	for in, expected := range map[string]string{
+		"2C:3E:51:AB:CD:EF":      RedactedMAC,
+		"2c-3e-51-ab-cd-ef":      "00-00-00-00-00-00",
+		"mac 2C3E51ABCDEF":       "mac 000000000000",
+		"a1b2c3d4e5f6":           "sm-1",
+		"5c8fb8fccdcda169da0000": "5c8fb8fccdcda169da0000",
+	} {
+		if got := redactString("mac", in, replacer); got != expected {
+			t.Errorf("redactString(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	c := &Cassette{Interactions: []Interaction{
+		{Method: "GET", URL: "/v1/info/sensor/x", Status: 200, Body: []byte(`{"priority": 1}`)},
+		{Method: "GET", URL: "/v1/info/sensor/x", Status: 200, Body: []byte(`{"priority": 2}`)},
+		{Method: "GET", URL: "/v1/info/sensor/y", Status: 502, BodyText: "Bad Gateway"},
+	}}
+	client := solarmanager.NewClient(&http.Client{Transport: NewReplayer(c)}, nil, "", "")
+	for _, expected := range []int{1, 2, 2} {
+		s, err := client.GetSensor("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Priority != expected {
+			t.Fatalf("unexpected priority, expected %d, but got %d", expected, s.Priority)
+		}
+	}
+	if _, err := client.GetSensor("y"); err == nil {
+		t.Fatal("expected error for replayed 502 response")
+	}
+}
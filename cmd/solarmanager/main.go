@@ -0,0 +1,237 @@
+// Command solarmanager queries the SolarManager API from the command line.
+//
+// Usage:
+//
+//	solarmanager [flags] <command> [arguments]
+//
+// Credentials are taken from the -username, -password and -id flags, the
+// SOLARMANAGER_USERNAME, SOLARMANAGER_PASSWORD and SOLARMANAGER_ID
+// environment variables, a YAML or TOML config file or ~/.netrc, in this
+// order. See package config for details.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+
+	"github.com/ingmarstein/solarmanager-go/config"
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+type command struct {
+	usage string
+	help  string
+	needs bool // whether the command requires a SolarManager ID
+	run   func(c *solarmanager.Client, smID string, args []string) (interface{}, error)
+	// interactive commands write to the terminal themselves until ctx is done.
+	interactive func(ctx context.Context, c *solarmanager.Client, smID string, args []string, w io.Writer) error
+}
+
+var commands = map[string]command{
+	"gateway": {
+		usage: "gateway",
+		help:  "show gateway information and settings",
+		needs: true,
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			return c.GetGatewayInfo(smID)
+		},
+	},
+	"sensors": {
+		usage: "sensors",
+		help:  "list all sensors",
+		needs: true,
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			return c.GetSensors(smID)
+		},
+	},
+	"sensor": {
+		usage: "sensor <sensor id>",
+		help:  "show a single sensor",
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			if len(args) != 1 {
+				return nil, errUsage
+			}
+			return c.GetSensor(args[0])
+		},
+	},
+	"live": {
+		usage: "live [sensor id]",
+		help:  "show live gateway data, or live data of a single sensor",
+		needs: true,
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			switch len(args) {
+			case 0:
+				return c.GetGatewayData(smID)
+			case 1:
+				return c.GetSensorData(smID, args[0])
+			default:
+				return nil, errUsage
+			}
+		},
+	},
+	"stats": {
+		usage: "stats [-period day|month|year] [-sensor <sensor id>]",
+		help:  "show consumption statistics of the gateway or a sensor",
+		needs: true,
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			period := fs.String("period", solarmanager.Day, "statistics period (day, month or year)")
+			sensorID := fs.String("sensor", "", "sensor id")
+			if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+				return nil, errUsage
+			}
+			switch *period {
+			case solarmanager.Day, solarmanager.Month, solarmanager.Year:
+			default:
+				return nil, errUsage
+			}
+			if *sensorID != "" {
+				return c.GetSensorConsumptionStatistics(*sensorID, solarmanager.StatisticPeriod(*period))
+			}
+			return c.GetGatewayConsumptionStatistics(smID, solarmanager.StatisticPeriod(*period))
+		},
+	},
+	"chart": {
+		usage: "chart",
+		help:  "show current energy flows",
+		needs: true,
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			return c.GetGatewayPieChart(smID)
+		},
+	},
+	"forecast": {
+		usage: "forecast",
+		help:  "show the PV production forecast",
+		needs: true,
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			return c.GetGatewayForecast(smID)
+		},
+	},
+	"top": {
+		usage:       "top [-interval 10s] [-window 10m]",
+		help:        "show a live dashboard of energy flows and devices",
+		needs:       true,
+		interactive: runTop,
+	},
+	"tariff": {
+		usage: "tariff",
+		help:  "show the low rate tariff times",
+		needs: true,
+		run: func(c *solarmanager.Client, smID string, args []string) (interface{}, error) {
+			return c.GetLowRateTariff(smID)
+		},
+	},
+}
+
+var errUsage = errors.New("invalid arguments")
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: solarmanager [flags] <command> [arguments]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-50s %s\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func run(args []string, getenv func(string) string, stdout, stderr io.Writer) error {
+	opts := config.Options{Getenv: getenv}
+	fs := flag.NewFlagSet("solarmanager", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.Path, "config", "", "path to a YAML or TOML config file")
+	fs.StringVar(&opts.Profile, "profile", "", "profile of the config file")
+	fs.StringVar(&opts.Username, "username", "", "SolarManager username")
+	fs.StringVar(&opts.Password, "password", "", "SolarManager password")
+	smIDFlag := fs.String("id", "", "SolarManager ID of the gateway")
+	fs.StringVar(&opts.BaseURL, "url", "", "API base URL")
+	output := fs.String("output", "table", "output format (table, json or yaml)")
+	verbose := fs.Bool("verbose", false, "dump HTTP requests and responses")
+	strict := fs.Bool("strict", false, "report response fields unknown to the client")
+	if err := fs.Parse(args); err != nil {
+		usage(stderr, fs)
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		usage(stderr, fs)
+		return errUsage
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		usage(stderr, fs)
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+	format, ok := formats[*output]
+	if !ok {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	if *smIDFlag != "" {
+		opts.SmIDs = []string{*smIDFlag}
+	}
+	cfg, err := config.Load(opts)
+	if err != nil {
+		return err
+	}
+	client, err := cfg.Client(nil)
+	if err != nil {
+		return err
+	}
+	var smID string
+	if cmd.needs {
+		if smID, err = cfg.SmID(); err != nil {
+			return err
+		}
+	} else if len(cfg.SmIDs) > 0 {
+		smID = cfg.SmIDs[0]
+	}
+	client.Verbose = *verbose
+	if *strict {
+		client.SchemaWarningHandler = func(w solarmanager.SchemaWarning) {
+			fmt.Fprintln(stderr, "warning:", w)
+		}
+	}
+
+	if cmd.interactive != nil {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err := cmd.interactive(ctx, client, smID, fs.Args()[1:], stdout)
+		if err == errUsage {
+			return fmt.Errorf("usage: solarmanager %s", cmd.usage)
+		}
+		return err
+	}
+
+	v, err := cmd.run(client, smID, fs.Args()[1:])
+	if err == errUsage {
+		return fmt.Errorf("usage: solarmanager %s", cmd.usage)
+	}
+	if err != nil {
+		return err
+	}
+	return format(stdout, v)
+}
+
+func main() {
+	err := run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "solarmanager:", err)
+		os.Exit(1)
+	}
+}
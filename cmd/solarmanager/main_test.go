@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/info/sensors/sm1", func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[{"_id": "5da07dc5d32a997fd7fb80aa", "priority": 7, "type": "Water Heater", "device_group": "myPV AC THOR", "signal": "connected", "tag": null}]`))
+	})
+	mux.HandleFunc("/v1/consumption/sensor/dev1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"sensorId": "dev1", "period": "` + r.URL.Query().Get("period") + `", "data": [{"createdAt": "2021-01-01", "consumption": 120.5}], "totalConsumption": 120.5}`))
+	})
+	svr := httptest.NewServer(mux)
+	t.Cleanup(svr.Close)
+	return svr
+}
+
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestSensorsTable(t *testing.T) {
+	svr := newTestServer(t)
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-url", svr.URL, "-id", "sm1", "sensors"}, env(map[string]string{
+		"SOLARMANAGER_USERNAME": "user",
+		"SOLARMANAGER_PASSWORD": "secret",
+		"SOLARMANAGER_CONFIG":   filepath.Join(t.TempDir(), "missing.yaml"),
+	}), &stdout, &stderr)
+	if err == nil {
+		t.Fatal("expected error for missing explicit config file")
+	}
+
+	err = run([]string{"-url", svr.URL, "-id", "sm1", "sensors"}, env(map[string]string{
+		"SOLARMANAGER_USERNAME": "user",
+		"SOLARMANAGER_PASSWORD": "secret",
+	}), &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "myPV AC THOR") {
+		t.Fatalf("unexpected table output:\n%s", stdout.String())
+	}
+}
+
+func TestStatsYAMLWithConfigFile(t *testing.T) {
+	svr := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("username: user\npassword: secret\nsm_id: sm1\nurl: "+svr.URL+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-config", path, "-output", "yaml", "stats", "-period", "month", "-sensor", "dev1"}, env(nil), &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "period: month\n") || !strings.Contains(stdout.String(), "consumption: 120.5\n") {
+		t.Fatalf("unexpected YAML output:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := run([]string{"-config", path, "stats", "-sensor", "dev1"}, env(nil), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "2021-01-01  120.5") || !strings.Contains(stdout.String(), "Total       120.5") {
+		t.Fatalf("unexpected table output:\n%s", stdout.String())
+	}
+
+	err = run([]string{"-config", path, "stats", "-period", "week"}, env(nil), &stdout, &stderr)
+	if err == nil || !strings.HasPrefix(err.Error(), "usage: solarmanager stats") {
+		t.Fatalf("unexpected error for unknown period %v", err)
+	}
+}
+
+func TestMissingCredentials(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-config", filepath.Join(t.TempDir(), "none.yaml"), "sensors"}, env(nil), &stdout, &stderr)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	empty := filepath.Join(t.TempDir(), "empty.yaml")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err = run([]string{"-config", empty, "-username", "u", "-password", "p", "sensors"}, env(nil), &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "SolarManager ID") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]float64{0, 500, 1000, 2000}, 2000); got != "▁▃▅█" {
+		t.Fatalf("unexpected sparkline %q", got)
+	}
+	if got := sparkline([]float64{0, 0}, 0); got != "▁▁" {
+		t.Fatalf("unexpected sparkline %q", got)
+	}
+}
+
+func TestRenderTop(t *testing.T) {
+	var chart solarmanager.GetGatewayPieChartResponse
+	err := json.Unmarshal([]byte(`{
+	"production": 20000,
+	"consumption": 5000,
+	"battery": {"capacity": 43},
+	"arrows": [
+		{"direction": "fromPVToGrid", "value": 15000},
+		{"direction": "fromGridToConsumer", "value": 0},
+		{"direction": "fromPVToConsumer", "value": 5000}
+	]
+}`), &chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	s := &topState{
+		sensors: map[string]solarmanager.SensorInfo{
+			"heater":  {Id: "heater", Priority: 7, Type: "Water Heater"},
+			"wallbox": {Id: "wallbox", Priority: 5, Type: "Car Charging"},
+		},
+		window: time.Minute,
+	}
+	data := solarmanager.GetGatewayDataResponse{Devices: []solarmanager.SensorData{
+		{Id: "heater", Signal: "connected"},
+		{Id: "wallbox", Signal: "not connected", Errors: []int{1}},
+	}}
+	s.add(now.Add(-2*time.Minute), data, chart)
+	s.add(now, data, chart)
+	if len(s.history) != 1 {
+		t.Fatalf("unexpected history length, expected 1, but got %d", len(s.history))
+	}
+
+	var buf bytes.Buffer
+	renderTop(&buf, s, now)
+	out := buf.String()
+	if !strings.Contains(out, "export 15 kW") {
+		t.Fatalf("missing grid export in output:\n%s", out)
+	}
+	if !strings.Contains(out, "25 %, autarky 100 %") {
+		t.Fatalf("missing self-consumption in output:\n%s", out)
+	}
+	if strings.Index(out, "Car Charging") > strings.Index(out, "Water Heater") {
+		t.Fatalf("devices not sorted by priority:\n%s", out)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+	"gopkg.in/yaml.v3"
+)
+
+var formats = map[string]func(w io.Writer, v interface{}) error{
+	"table": writeTable,
+	"json":  writeJSON,
+	"yaml":  writeYAML,
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML writes v as YAML using the field names of the JSON API rather
+// than the Go field names.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(generic); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func row(w io.Writer, columns ...interface{}) {
+	s := make([]string, len(columns))
+	for i, c := range columns {
+		s[i] = fmt.Sprint(c)
+	}
+	fmt.Fprintln(w, strings.Join(s, "\t"))
+}
+
+// formatOptional formats o with the given unit, or "-" if it is not set.
+// Power and energy values carry their unit already.
+func formatOptional[T any](o solarmanager.Optional[T], unit string) string {
+	v, ok := o.Get()
+	if !ok {
+		return "-"
+	}
+	if unit == "" {
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprint(v) + " " + unit
+}
+
+// formatNumber formats a value for a column whose header names the unit.
+func formatNumber[T ~float64](v T) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 64)
+}
+
+func errorList(errors []int) string {
+	if len(errors) == 0 {
+		return "-"
+	}
+	s := make([]string, len(errors))
+	for i, e := range errors {
+		s[i] = strconv.Itoa(e)
+	}
+	return strings.Join(s, ",")
+}
+
+func writeTable(out io.Writer, v interface{}) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	switch v := v.(type) {
+	case solarmanager.GetGatewayInfoResponse:
+		row(w, "Name:", v.Gateway.Name)
+		row(w, "SolarManager ID:", v.Gateway.SmId)
+		row(w, "Signal:", v.Gateway.Signal)
+		row(w, "Firmware:", v.Gateway.Firmware)
+		row(w, "IP:", v.Gateway.Ip)
+		row(w, "MAC:", v.Gateway.Mac)
+		row(w, "Last error:", formatTime(v.Gateway.LastErrorDate))
+		row(w, "Peak power:", fmt.Sprintf("%.2f kWp", v.Settings.KWp))
+		row(w, "House fuse:", fmt.Sprintf("%d A", v.Settings.HouseFuse))
+		row(w, "Tariff type:", v.Settings.TariffType)
+	case solarmanager.GetSensorsResponse:
+		row(w, "ID", "PRIORITY", "TYPE", "DEVICE GROUP", "SIGNAL", "IP", "TAG")
+		for _, s := range v {
+			sensorRow(w, solarmanager.GetSensorResponse(s))
+		}
+	case solarmanager.GetSensorResponse:
+		row(w, "ID", "PRIORITY", "TYPE", "DEVICE GROUP", "SIGNAL", "IP", "TAG")
+		sensorRow(w, v)
+	case solarmanager.GetGatewayDataResponse:
+		row(w, "Time:", formatTime(v.TimeStamp))
+		row(w, "PV generation:", v.CurrentPvGeneration)
+		row(w, "Consumption:", v.CurrentPowerConsumption)
+		row(w, "Battery:", fmt.Sprintf("%v (%d %%)", v.CurrentBatteryChargeDischarge, v.Soc))
+		row(w, "Errors:", errorList(v.Errors))
+		row(w)
+		row(w, "ID", "SIGNAL", "POWER", "SWITCH", "WATER TEMP", "SOC", "ERRORS")
+		for _, d := range v.Devices {
+			row(w, d.Id, d.Signal, formatOptional(d.CurrentPower, ""), formatOptional(d.SwitchState, ""), formatOptional(d.CurrentWaterTemp, ""), formatOptional(d.SOC, ""), errorList(d.Errors))
+		}
+	case solarmanager.GetSensorDataResponse:
+		row(w, "Time:", formatTime(v.Date))
+		row(w, "ID:", v.Data.Id)
+		row(w, "Signal:", v.Data.Signal)
+		row(w, "Power:", formatOptional(v.Data.CurrentPower, ""))
+		row(w, "Switch state:", formatOptional(v.Data.SwitchState, ""))
+		row(w, "Water temperature:", formatOptional(v.Data.CurrentWaterTemp, "°C"))
+		row(w, "SOC:", formatOptional(v.Data.SOC, "%"))
+		row(w, "Errors:", errorList(v.Data.Errors))
+	case solarmanager.GetGatewayConsumptionStatisticsResponse:
+		statsTable(w, v.Data, v.TotalConsumption, true)
+	case solarmanager.GetSensorConsumptionStatisticsResponse:
+		data := make([]solarmanager.GatewayConsumption, len(v.Data))
+		for i, d := range v.Data {
+			data[i] = solarmanager.GatewayConsumption{CreatedAt: d.CreatedAt, Consumption: d.Consumption}
+		}
+		statsTable(w, data, v.TotalConsumption, false)
+	case solarmanager.GetGatewayPieChartResponse:
+		row(w, "Last update:", formatTime(v.LastUpdate))
+		row(w, "Production:", v.Production)
+		row(w, "Consumption:", v.Consumption)
+		row(w, "Battery:", fmt.Sprintf("%d %% (charging %v, discharging %v)", v.Battery.Capacity, v.Battery.BatteryCharging, v.Battery.BatteryDischarging))
+		row(w)
+		row(w, "DIRECTION", "POWER [W]")
+		for _, a := range v.Arrows {
+			row(w, a.Direction, formatNumber(a.Value))
+		}
+	case solarmanager.GetGatewayForecastResponse:
+		row(w, "TIME", "EXPECTED [W]", "MIN [W]", "MAX [W]")
+		for _, e := range v {
+			row(w, formatTime(time.UnixMilli(e.Timestamp)), formatNumber(e.Expected), formatNumber(e.Min), formatNumber(e.Max))
+		}
+	case solarmanager.GetLowRateTariffResponse:
+		row(w, "DAYS", "FROM", "TO")
+		row(w, "Monday-Friday", v.MondayFridayFrom, v.MondayFridayTo)
+		row(w, "Saturday", v.SatudayFrom, v.SatudayTo)
+		row(w, "Sunday", v.SundayFrom, v.SundayTo)
+	default:
+		return writeYAML(out, v)
+	}
+	return w.Flush()
+}
+
+func sensorRow(w io.Writer, s solarmanager.GetSensorResponse) {
+	tag := s.Tag.Name
+	if tag == "" {
+		tag = "-"
+	}
+	row(w, s.Id, s.Priority, s.Type, s.DeviceGroup, s.Signal, s.Ip, tag)
+}
+
+// statsTable writes consumption statistics of a gateway or, without the
+// production column, of a sensor.
+func statsTable(w io.Writer, data []solarmanager.GatewayConsumption, total solarmanager.WattHour, production bool) {
+	header := []interface{}{"DATE", "CONSUMPTION [Wh]"}
+	if production {
+		header = append(header, "PRODUCTION [Wh]")
+	}
+	row(w, header...)
+	for _, d := range data {
+		columns := []interface{}{d.CreatedAt, formatNumber(d.Consumption)}
+		if production {
+			columns = append(columns, formatNumber(d.Production))
+		}
+		row(w, columns...)
+	}
+	row(w, "Total", formatNumber(total))
+}
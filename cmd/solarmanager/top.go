@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/analytics"
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// sample is a point of the power history shown as sparklines.
+type sample struct {
+	time        time.Time
+	production  solarmanager.Watt
+	consumption solarmanager.Watt
+}
+
+// topState holds everything rendered by the top dashboard.
+type topState struct {
+	sensors map[string]solarmanager.SensorInfo
+	data    solarmanager.GetGatewayDataResponse
+	chart   solarmanager.GetGatewayPieChartResponse
+	history []sample
+	window  time.Duration
+	err     error
+}
+
+func (s *topState) add(now time.Time, data solarmanager.GetGatewayDataResponse, chart solarmanager.GetGatewayPieChartResponse) {
+	s.data = data
+	s.chart = chart
+	s.history = append(s.history, sample{now, chart.Production, chart.Consumption})
+	cutoff := now.Add(-s.window)
+	i := 0
+	for i < len(s.history) && s.history[i].time.Before(cutoff) {
+		i++
+	}
+	s.history = s.history[i:]
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values scaled to the range [0, max] using block elements.
+func sparkline(values []float64, max float64) string {
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 && v > 0 {
+			i = int(math.Round(v / max * float64(len(sparks)-1)))
+			if i >= len(sparks) {
+				i = len(sparks) - 1
+			}
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+func renderTop(out io.Writer, s *topState, now time.Time) {
+	fmt.Fprintf(out, "SolarManager  %s  (window %s)\n\n", now.Local().Format(time.DateTime), s.window)
+
+	k := analytics.FromPieChart(s.chart)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	production := make([]float64, len(s.history))
+	consumption := make([]float64, len(s.history))
+	max := 0.0
+	for i, h := range s.history {
+		production[i] = float64(h.production)
+		consumption[i] = float64(h.consumption)
+		max = math.Max(max, math.Max(production[i], consumption[i]))
+	}
+	row(w, "PV", s.chart.Production, sparkline(production, max))
+	row(w, "Consumption", s.chart.Consumption, sparkline(consumption, max))
+	row(w, "Grid", fmt.Sprintf("import %v / export %v", k.GridImport, k.GridExport))
+	row(w, "Battery", fmt.Sprintf("%d %%, charge %v / discharge %v", s.chart.Battery.Capacity, k.BatteryCharge, k.BatteryDischarge))
+	row(w, "Self-consumption", fmt.Sprintf("%.0f %%, autarky %.0f %%", 100*k.SelfConsumptionRatio(), 100*k.Autarky()))
+	row(w)
+
+	devices := append([]solarmanager.SensorData(nil), s.data.Devices...)
+	sort.SliceStable(devices, func(i, j int) bool {
+		return s.sensors[devices[i].Id].Priority < s.sensors[devices[j].Id].Priority
+	})
+	row(w, "PRIO", "TYPE", "DEVICE GROUP", "SIGNAL", "POWER", "ERRORS")
+	for _, d := range devices {
+		info := s.sensors[d.Id]
+		typ := info.Type
+		if typ == "" {
+			typ = d.Id
+		}
+		row(w, info.Priority, typ, info.DeviceGroup, d.Signal, formatOptional(d.CurrentPower, ""), errorList(d.Errors))
+	}
+	w.Flush()
+
+	if s.err != nil {
+		fmt.Fprintf(out, "\nerror: %v\n", s.err)
+	}
+}
+
+func runTop(ctx context.Context, c *solarmanager.Client, smID string, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	interval := fs.Duration("interval", 10*time.Second, "refresh interval")
+	window := fs.Duration("window", 10*time.Minute, "time span covered by the sparklines")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *interval <= 0 {
+		return errUsage
+	}
+
+	sensors, err := c.GetSensorsContext(ctx, smID)
+	if err != nil {
+		return err
+	}
+	s := &topState{
+		sensors: make(map[string]solarmanager.SensorInfo, len(sensors)),
+		window:  *window,
+	}
+	for _, info := range sensors {
+		s.sensors[info.Id] = info
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		data, err := c.GetGatewayDataContext(ctx, smID)
+		var chart solarmanager.GetGatewayPieChartResponse
+		if err == nil {
+			chart, err = c.GetGatewayPieChartContext(ctx, smID)
+		}
+		if ctx.Err() != nil {
+			// Interrupted while fetching.
+			return nil
+		}
+		s.err = err
+		now := time.Now()
+		if err == nil {
+			s.add(now, data, chart)
+		}
+		// Clear the screen and move the cursor home before redrawing.
+		fmt.Fprint(out, "\x1b[H\x1b[2J")
+		renderTop(out, s, now)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
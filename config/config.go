@@ -0,0 +1,337 @@
+// Package config resolves SolarManager credentials and gateway IDs from
+// explicit options, environment variables, a config file and ~/.netrc, and
+// creates clients from them.
+//
+// Each setting is taken from the first source that provides it:
+//
+//  1. the fields of Options
+//  2. the environment variables SOLARMANAGER_USERNAME, SOLARMANAGER_PASSWORD,
+//     SOLARMANAGER_ID (a comma-separated list) and SOLARMANAGER_URL, or the
+//     file named by the same variable with a _FILE suffix, e.g.
+//     SOLARMANAGER_PASSWORD_FILE=/run/secrets/solarmanager for Docker secrets
+//  3. the selected profile of the config file
+//  4. the top level of the config file, except for the username and
+//     password if the selected profile sets either of them
+//  5. the ~/.netrc entry for the host of the base URL (username and password
+//     only)
+//
+// The config file is YAML, or TOML if its name ends in .toml:
+//
+//	username: user@example.com
+//	password_file: /run/secrets/solarmanager
+//	profiles:
+//	  home:
+//	    sm_id: a1b2c3d4e5f6
+//	  office:
+//	    username: office@example.com
+//	    sm_ids: [0123456789ab, ba9876543210]
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// DefaultBaseURL is the base URL used if none is configured.
+const DefaultBaseURL = "https://cloud.solar-manager.ch/"
+
+// Options are explicitly set values, e.g. from command-line flags, and the
+// locations of the other sources. Empty fields are ignored.
+type Options struct {
+	Username string
+	Password string
+	SmIDs    []string
+	BaseURL  string
+
+	// Path is the config file. If empty, SOLARMANAGER_CONFIG is used, and
+	// then DefaultPath if that file exists.
+	Path string
+	// Profile selects a profile of the config file. If empty,
+	// SOLARMANAGER_PROFILE is used.
+	Profile string
+	// Getenv looks up environment variables. It defaults to os.Getenv.
+	Getenv func(string) string
+}
+
+// Config is the resolved configuration.
+type Config struct {
+	Username string
+	Password string
+	SmIDs    []string
+	BaseURL  string
+
+	// Path is the config file that was read, if any.
+	Path string
+}
+
+// MissingError reports a setting that isn't provided by any source.
+type MissingError struct {
+	Setting string
+	// Sources describes where the setting can be provided.
+	Sources []string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("config: missing %s, set %s", e.Setting, strings.Join(e.Sources, " or "))
+}
+
+// DefaultPath returns the default location of the config file,
+// solarmanager/config.yaml in the user's config directory. If that doesn't
+// exist but solarmanager/config.toml does, the latter is returned.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "solarmanager", "config.yaml")
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		toml := filepath.Join(dir, "solarmanager", "config.toml")
+		if _, err := os.Stat(toml); err == nil {
+			return toml
+		}
+	}
+	return path
+}
+
+// profile is a set of settings in the config file.
+type profile struct {
+	Username     string   `yaml:"username" toml:"username"`
+	Password     string   `yaml:"password" toml:"password"`
+	PasswordFile string   `yaml:"password_file" toml:"password_file"`
+	SmID         string   `yaml:"sm_id" toml:"sm_id"`
+	SmIDs        []string `yaml:"sm_ids" toml:"sm_ids"`
+	URL          string   `yaml:"url" toml:"url"`
+}
+
+func (p *profile) hasCredentials() bool {
+	return p.Username != "" || p.Password != "" || p.PasswordFile != ""
+}
+
+type file struct {
+	profile  `yaml:",inline"`
+	Profiles map[string]profile `yaml:"profiles" toml:"profiles"`
+}
+
+// Load resolves the configuration. It fails if the config file can't be
+// read, except for a missing file at the default path, or if the selected
+// profile doesn't exist. Missing settings are only reported by Client and
+// SmID.
+func Load(opts Options) (*Config, error) {
+	getenv := opts.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	c := &Config{
+		Username: opts.Username,
+		Password: opts.Password,
+		SmIDs:    opts.SmIDs,
+		BaseURL:  opts.BaseURL,
+	}
+
+	for _, v := range []struct {
+		name string
+		dst  *string
+	}{
+		{"SOLARMANAGER_USERNAME", &c.Username},
+		{"SOLARMANAGER_PASSWORD", &c.Password},
+		{"SOLARMANAGER_URL", &c.BaseURL},
+	} {
+		s, err := lookupEnv(getenv, v.name)
+		if err != nil {
+			return nil, err
+		}
+		setDefault(v.dst, s)
+	}
+	ids, err := lookupEnv(getenv, "SOLARMANAGER_ID")
+	if err != nil {
+		return nil, err
+	}
+	if len(c.SmIDs) == 0 {
+		c.SmIDs = splitList(ids)
+	}
+
+	if err := c.loadFile(opts, getenv); err != nil {
+		return nil, err
+	}
+
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	if c.Password == "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("config: invalid base URL: %w", err)
+		}
+		login, password, err := lookupNetrc(netrcPath(getenv), u.Hostname(), c.Username)
+		if err != nil {
+			return nil, err
+		}
+		if password != "" {
+			setDefault(&c.Username, login)
+			c.Password = password
+		}
+	}
+	return c, nil
+}
+
+func (c *Config) loadFile(opts Options, getenv func(string) string) error {
+	path := opts.Path
+	setDefault(&path, getenv("SOLARMANAGER_CONFIG"))
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+	name := opts.Profile
+	setDefault(&name, getenv("SOLARMANAGER_PROFILE"))
+
+	var f file
+	data, err := os.ReadFile(path)
+	switch {
+	case path == "" || !explicit && errors.Is(err, fs.ErrNotExist):
+		if name != "" {
+			return fmt.Errorf("config: profile %q requires a config file", name)
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("config: %w", err)
+	case strings.EqualFold(filepath.Ext(path), ".toml"):
+		err = toml.Unmarshal(data, &f)
+	default:
+		err = yaml.Unmarshal(data, &f)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	c.Path = path
+
+	sources := []profile{f.profile}
+	if name != "" {
+		p, ok := f.Profiles[name]
+		if !ok {
+			return fmt.Errorf("config: profile %q not found in %s", name, path)
+		}
+		top := f.profile
+		if p.hasCredentials() {
+			// The credentials of a profile belong together, so that a
+			// profile of another account doesn't inherit the top level
+			// password.
+			top.Username, top.Password, top.PasswordFile = "", "", ""
+		}
+		sources = []profile{p, top}
+	}
+	for _, p := range sources {
+		setDefault(&c.Username, p.Username)
+		setDefault(&c.BaseURL, p.URL)
+		if c.Password == "" && p.PasswordFile != "" {
+			s, err := readSecret(p.PasswordFile)
+			if err != nil {
+				return err
+			}
+			c.Password = s
+		}
+		setDefault(&c.Password, p.Password)
+		if len(c.SmIDs) == 0 {
+			c.SmIDs = p.SmIDs
+		}
+		if len(c.SmIDs) == 0 && p.SmID != "" {
+			c.SmIDs = []string{p.SmID}
+		}
+	}
+	return nil
+}
+
+// Client returns a client for the configured account, using httpClient if
+// it isn't nil. It fails if the username or password is missing.
+func (c *Config) Client(httpClient *http.Client) (*solarmanager.Client, error) {
+	if c.Username == "" {
+		return nil, c.missing("username", "SOLARMANAGER_USERNAME", "username")
+	}
+	if c.Password == "" {
+		return nil, c.missing("password", "SOLARMANAGER_PASSWORD", "password")
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid base URL: %w", err)
+	}
+	return solarmanager.NewClient(httpClient, u, c.Username, c.Password), nil
+}
+
+// SmID returns the first configured SolarManager ID.
+func (c *Config) SmID() (string, error) {
+	if len(c.SmIDs) == 0 {
+		return "", c.missing("SolarManager ID", "SOLARMANAGER_ID", "sm_id")
+	}
+	return c.SmIDs[0], nil
+}
+
+func (c *Config) missing(setting, env, key string) *MissingError {
+	sources := []string{env, env + "_FILE", key + " in the config file"}
+	if key == "username" || key == "password" {
+		if u, err := url.Parse(c.BaseURL); err == nil {
+			sources = append(sources, "a .netrc entry for "+u.Hostname())
+		}
+	}
+	return &MissingError{Setting: setting, Sources: sources}
+}
+
+// NewClient loads the configuration and returns a client for it.
+func NewClient(opts Options) (*solarmanager.Client, *Config, error) {
+	c, err := Load(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := c.Client(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, c, nil
+}
+
+// lookupEnv returns the environment variable name, or the contents of the
+// file named by name_FILE.
+func lookupEnv(getenv func(string) string, name string) (string, error) {
+	if v := getenv(name); v != "" {
+		return v, nil
+	}
+	if path := getenv(name + "_FILE"); path != "" {
+		return readSecret(path)
+	}
+	return "", nil
+}
+
+// readSecret returns the contents of a secret file without the trailing
+// newline.
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("config: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func setDefault(s *string, v string) {
+	if *s == "" {
+		*s = v
+	}
+}
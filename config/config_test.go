@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	secret := writeFile(t, "secret", "from-secret\n")
+	path := writeFile(t, "config.yaml", `
+username: top
+password: top-secret
+url: https://example.com/
+profiles:
+  office:
+    username: office
+    sm_ids: [sm2, sm3]
+`)
+
+	c, err := Load(Options{
+		Path:    path,
+		Profile: "office",
+		BaseURL: "https://explicit.example.com/",
+		Getenv: env(map[string]string{
+			"SOLARMANAGER_PASSWORD_FILE": secret,
+			"SOLARMANAGER_URL":           "https://env.example.com/",
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Config{
+		Username: "office",
+		Password: "from-secret",
+		SmIDs:    []string{"sm2", "sm3"},
+		BaseURL:  "https://explicit.example.com/",
+		Path:     path,
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("unexpected config %+v", c)
+	}
+
+	c, err = Load(Options{Path: path, Getenv: env(map[string]string{"SOLARMANAGER_ID": "sm1, sm4"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "top" || c.Password != "top-secret" || !reflect.DeepEqual(c.SmIDs, []string{"sm1", "sm4"}) {
+		t.Fatalf("unexpected config %+v", c)
+	}
+
+	if _, err := Load(Options{Path: path, Profile: "home", Getenv: env(nil)}); err == nil || !strings.Contains(err.Error(), `profile "home" not found`) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := Load(Options{Getenv: env(map[string]string{"SOLARMANAGER_CONFIG": path + ".missing"})}); err == nil {
+		t.Fatal("expected error for missing explicit config file")
+	}
+}
+
+func TestProfileCredentials(t *testing.T) {
+	secret := writeFile(t, "secret", "office-secret")
+	path := writeFile(t, "config.yaml", `
+username: top
+password: top-secret
+profiles:
+  office:
+    username: office
+  shared:
+    password_file: `+secret+`
+  home:
+    sm_id: sm1
+`)
+	for _, tc := range []struct {
+		profile            string
+		username, password string
+	}{
+		{"office", "office", ""},
+		{"shared", "", "office-secret"},
+		{"home", "top", "top-secret"},
+	} {
+		c, err := Load(Options{Path: path, Profile: tc.profile, Getenv: env(map[string]string{"NETRC": filepath.Join(t.TempDir(), "netrc")})})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Username != tc.username || c.Password != tc.password {
+			t.Fatalf("%s: unexpected credentials %q, %q", tc.profile, c.Username, c.Password)
+		}
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	secret := writeFile(t, "secret", "s3cret")
+	path := writeFile(t, "config.toml", `
+username = "top"
+password_file = "`+secret+`"
+
+[profiles.home]
+sm_id = "sm1"
+`)
+	c, err := Load(Options{Path: path, Getenv: env(map[string]string{"SOLARMANAGER_PROFILE": "home"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "top" || c.Password != "s3cret" || !reflect.DeepEqual(c.SmIDs, []string{"sm1"}) || c.BaseURL != DefaultBaseURL {
+		t.Fatalf("unexpected config %+v", c)
+	}
+}
+
+func TestNetrc(t *testing.T) {
+	netrc := writeFile(t, "netrc", `
+machine example.com login other password wrong
+machine cloud.solar-manager.ch
+	login user
+	password secret
+machine cloud.solar-manager.ch login bob password bobs
+default login anonymous password guest
+macdef init
+	cd /pub
+`)
+	c, err := Load(Options{Path: writeFile(t, "empty.yaml", ""), Getenv: env(map[string]string{"NETRC": netrc})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "user" || c.Password != "secret" {
+		t.Fatalf("unexpected credentials %q %q", c.Username, c.Password)
+	}
+
+	// An explicit username selects the entry with the same login.
+	c, err = Load(Options{Username: "bob", Path: writeFile(t, "empty.yaml", ""), Getenv: env(map[string]string{"NETRC": netrc})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "bob" || c.Password != "bobs" {
+		t.Fatalf("unexpected credentials %q %q", c.Username, c.Password)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	c, err := Load(Options{
+		Username: "user",
+		Path:     writeFile(t, "empty.yaml", ""),
+		Getenv:   env(map[string]string{"NETRC": filepath.Join(t.TempDir(), "none")}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Client(nil)
+	var missing *MissingError
+	if !errors.As(err, &missing) || missing.Setting != "password" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !strings.Contains(err.Error(), "SOLARMANAGER_PASSWORD_FILE") || !strings.Contains(err.Error(), "cloud.solar-manager.ch") {
+		t.Fatalf("unhelpful error %q", err)
+	}
+	if _, err := c.SmID(); err == nil || !strings.Contains(err.Error(), "missing SolarManager ID") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	c.Password = "secret"
+	client, err := c.Client(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Username != "user" || client.BaseURL.String() != DefaultBaseURL {
+		t.Fatalf("unexpected client %+v", client)
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcPath returns the file named by NETRC, or .netrc in the home
+// directory (_netrc on Windows).
+func netrcPath(getenv func(string) string) string {
+	if path := getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// lookupNetrc returns the login and password of the netrc entry for host,
+// falling back to the default entry. If login is not empty, only entries
+// without a login or with the same login match. A missing file is not an
+// error.
+func lookupNetrc(path, host, login string) (string, string, error) {
+	if path == "" {
+		return "", "", nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", fmt.Errorf("config: %w", err)
+	}
+
+	type entry struct {
+		machine   string
+		isDefault bool
+		login     string
+		password  string
+	}
+	var entries []*entry
+	var e *entry
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		next := func() string {
+			if i+1 < len(fields) {
+				i++
+				return fields[i]
+			}
+			return ""
+		}
+		switch fields[i] {
+		case "machine":
+			e = &entry{machine: next()}
+			entries = append(entries, e)
+		case "default":
+			e = &entry{isDefault: true}
+			entries = append(entries, e)
+		case "login":
+			if v := next(); e != nil {
+				e.login = v
+			}
+		case "password":
+			if v := next(); e != nil {
+				e.password = v
+			}
+		case "account":
+			next()
+		case "macdef":
+			// Macro definitions are free-form text up to an empty line and
+			// conventionally come last, so the rest of the file is ignored.
+			i = len(fields)
+		}
+	}
+
+	for _, want := range []bool{false, true} {
+		for _, e := range entries {
+			if e.isDefault != want || !want && !strings.EqualFold(e.machine, host) {
+				continue
+			}
+			if login != "" && e.login != "" && e.login != login {
+				continue
+			}
+			return e.login, e.password, nil
+		}
+	}
+	return "", "", nil
+}
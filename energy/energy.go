@@ -0,0 +1,273 @@
+// Package energy accumulates the energy of devices from polled power
+// samples, e.g. of GetGatewayData or GetSensorData, into buckets aligned to
+// quarter hours, hours or days.
+package energy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+const (
+	// DefaultMaxGap is the MaxGap of integrators returned by New.
+	DefaultMaxGap = 5 * time.Minute
+	// DefaultMaxSkew is the MaxSkew of integrators returned by New.
+	DefaultMaxSkew = time.Minute
+)
+
+// Sample is the power of a device at a point in time.
+type Sample struct {
+	Device string
+	Time   time.Time
+	Power  solarmanager.Watt
+	// Counter is the energy meter reading of the device, if it has one. If
+	// two consecutive samples have a reading, their difference is used
+	// instead of the integrated power.
+	Counter solarmanager.Optional[solarmanager.WattHour]
+}
+
+// Interval is the length of buckets.
+type Interval int
+
+const (
+	QuarterHour Interval = iota
+	Hour
+	Day
+)
+
+// bounds returns the bucket containing t. Buckets are aligned to the wall
+// clock in loc, so days may be 23 or 25 hours long.
+func (i Interval) bounds(t time.Time, loc *time.Location) (start, end time.Time) {
+	t = t.In(loc)
+	if i == Day {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	}
+	length := int64(15 * 60)
+	if i == Hour {
+		length = 60 * 60
+	}
+	// Truncate the local time, so that zones with offsets that are not
+	// whole hours are aligned, too.
+	_, offset := t.Zone()
+	local := t.Unix() + int64(offset)
+	start = time.Unix(local-local%length-int64(offset), 0).In(loc)
+	return start, start.Add(time.Duration(length) * time.Second)
+}
+
+// GapPolicy determines how gaps between samples are handled.
+type GapPolicy int
+
+const (
+	// Interpolate integrates the power linearly across gaps.
+	Interpolate GapPolicy = iota
+	// Drop ignores the energy of gaps.
+	Drop
+)
+
+// Bucket is the energy of a device in an interval.
+type Bucket struct {
+	Device string
+	Start  time.Time
+	End    time.Time
+	Energy solarmanager.WattHour
+}
+
+// Stats counts the irregularities of the samples.
+type Stats struct {
+	Samples       int // samples added
+	Gaps          int // intervals longer than MaxGap
+	OutOfOrder    int // samples dropped because they weren't newer than the previous one
+	ClockResets   int // samples that went back in time by more than MaxSkew
+	CounterResets int // decreasing Counter readings
+	Late          int // samples dropped because their interval has been flushed
+}
+
+// Integrator accumulates energy from power samples using the trapezoidal
+// rule, i.e. assuming that the power changes linearly between samples. It
+// is safe for concurrent use.
+type Integrator struct {
+	Interval Interval
+	// Location is the time zone the buckets are aligned in, usually that of
+	// the gateway.
+	Location *time.Location
+	// MaxGap is the longest interval between two samples of a device that
+	// is integrated normally. Longer gaps are handled according to Gap.
+	MaxGap time.Duration
+	Gap    GapPolicy
+	// MaxSkew is how far a sample may go back in time to be dropped as out
+	// of order. If it goes back further, the clock of the device is assumed
+	// to have been reset, and integration restarts from the sample.
+	MaxSkew time.Duration
+
+	mu      sync.Mutex
+	last    map[string]Sample
+	flushed map[string]time.Time // end of the last flushed bucket per device
+	buckets map[bucketKey]*Bucket
+	stats   Stats
+}
+
+type bucketKey struct {
+	device string
+	start  int64 // Unix time
+}
+
+// New returns an integrator with buckets of the given interval, aligned in
+// loc. If loc is nil, UTC is used.
+func New(interval Interval, loc *time.Location) *Integrator {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Integrator{
+		Interval: interval,
+		Location: loc,
+		MaxGap:   DefaultMaxGap,
+		Gap:      Interpolate,
+		MaxSkew:  DefaultMaxSkew,
+		last:     make(map[string]Sample),
+		flushed:  make(map[string]time.Time),
+		buckets:  make(map[bucketKey]*Bucket),
+	}
+}
+
+// Add adds samples, which should be in chronological order per device.
+func (in *Integrator) Add(samples ...Sample) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, s := range samples {
+		in.add(s)
+	}
+}
+
+func (in *Integrator) add(s Sample) {
+	in.stats.Samples++
+	prev, ok := in.last[s.Device]
+	if !ok {
+		in.last[s.Device] = s
+		return
+	}
+	dt := s.Time.Sub(prev.Time)
+	switch {
+	case dt <= 0 && -dt > in.MaxSkew:
+		// The samples after a clock reset would all be late if the
+		// device's buckets have been flushed since.
+		in.stats.ClockResets++
+		delete(in.flushed, s.Device)
+		in.last[s.Device] = s
+		return
+	case dt <= 0:
+		in.stats.OutOfOrder++
+		return
+	case s.Time.Before(in.flushed[s.Device]):
+		in.stats.Late++
+		return
+	case in.MaxGap > 0 && dt > in.MaxGap:
+		in.stats.Gaps++
+		if in.Gap == Drop {
+			in.last[s.Device] = s
+			return
+		}
+	}
+	in.integrate(prev, s)
+	in.last[s.Device] = s
+}
+
+// integrate adds the energy between a and b to the buckets they span.
+func (in *Integrator) integrate(a, b Sample) {
+	power := func(t time.Time) float64 {
+		f := float64(t.Sub(a.Time)) / float64(b.Time.Sub(a.Time))
+		return float64(a.Power) + f*float64(b.Power-a.Power)
+	}
+	trapezoid := func(from, to time.Time) float64 {
+		return (power(from) + power(to)) / 2 * to.Sub(from).Hours()
+	}
+
+	// With meter readings, distribute their difference in proportion to the
+	// integrated power, or to time if that is 0.
+	scale := 1.0
+	byTime := false
+	if a.Counter.Set && b.Counter.Set {
+		if delta := float64(b.Counter.Value - a.Counter.Value); delta < 0 {
+			in.stats.CounterResets++
+		} else if total := trapezoid(a.Time, b.Time); total != 0 {
+			scale = delta / total
+		} else {
+			scale, byTime = delta/b.Time.Sub(a.Time).Hours(), true
+		}
+	}
+
+	for from := a.Time; from.Before(b.Time); {
+		start, end := in.Interval.bounds(from, in.Location)
+		to := end
+		if b.Time.Before(to) {
+			to = b.Time
+		}
+		var e float64
+		if byTime {
+			e = scale * to.Sub(from).Hours()
+		} else {
+			e = scale * trapezoid(from, to)
+		}
+		key := bucketKey{a.Device, start.Unix()}
+		bucket := in.buckets[key]
+		if bucket == nil {
+			bucket = &Bucket{Device: a.Device, Start: start, End: end}
+			in.buckets[key] = bucket
+		}
+		bucket.Energy += solarmanager.WattHour(e)
+		from = to
+	}
+}
+
+// Buckets returns all buckets, sorted by device and start time.
+func (in *Integrator) Buckets() []Bucket {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	buckets := make([]Bucket, 0, len(in.buckets))
+	for _, b := range in.buckets {
+		buckets = append(buckets, *b)
+	}
+	sortBuckets(buckets)
+	return buckets
+}
+
+// Flush removes and returns the complete buckets that end at or before t,
+// sorted by device and start time. A bucket is complete once its device has
+// a sample at or after its end. Later samples before the end of a flushed
+// bucket are dropped, unless the clock of the device has been reset.
+func (in *Integrator) Flush(t time.Time) []Bucket {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	var buckets []Bucket
+	for key, b := range in.buckets {
+		if b.End.After(t) || in.last[b.Device].Time.Before(b.End) {
+			continue
+		}
+		buckets = append(buckets, *b)
+		delete(in.buckets, key)
+		if b.End.After(in.flushed[b.Device]) {
+			in.flushed[b.Device] = b.End
+		}
+	}
+	sortBuckets(buckets)
+	return buckets
+}
+
+// Stats returns the irregularities encountered so far.
+func (in *Integrator) Stats() Stats {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.stats
+}
+
+func sortBuckets(buckets []Bucket) {
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Device != buckets[j].Device {
+			return buckets[i].Device < buckets[j].Device
+		}
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+}
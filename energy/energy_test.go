@@ -0,0 +1,213 @@
+package energy
+
+import (
+	"math"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+func approx(a, b solarmanager.WattHour) bool {
+	return math.Abs(float64(a-b)) < 1e-6
+}
+
+func TestTrapezoid(t *testing.T) {
+	t0 := time.Date(2021, 4, 7, 12, 10, 0, 0, time.UTC)
+	in := New(QuarterHour, nil)
+	// The power ramps from 0 to 2000 W over 20 minutes, sampled at the
+	// start and end only.
+	in.Add(
+		Sample{Device: "pv", Time: t0, Power: 0},
+		Sample{Device: "pv", Time: t0.Add(20 * time.Minute), Power: 2000},
+	)
+	buckets := in.Buckets()
+	if len(buckets) != 2 {
+		t.Fatalf("unexpected buckets %+v", buckets)
+	}
+	// 12:10-12:15 ramps from 0 to 500 W, 12:15-12:30 from 500 to 2000 W.
+	if b := buckets[0]; !b.Start.Equal(t0.Add(-10*time.Minute)) || !approx(b.Energy, 250.0/12) {
+		t.Fatalf("unexpected bucket %+v", b)
+	}
+	if b := buckets[1]; !b.End.Equal(t0.Add(20*time.Minute)) || !approx(b.Energy, 1250.0/4) {
+		t.Fatalf("unexpected bucket %+v", b)
+	}
+
+	if flushed := in.Flush(t0.Add(10 * time.Minute)); len(flushed) != 1 || !flushed[0].Start.Equal(buckets[0].Start) {
+		t.Fatalf("unexpected flushed buckets %+v", flushed)
+	}
+	if n := len(in.Buckets()); n != 1 {
+		t.Fatalf("expected 1 remaining bucket, got %d", n)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	t0 := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	in := New(QuarterHour, nil)
+	in.Add(
+		Sample{Device: "d", Time: t0, Power: 1200},
+		Sample{Device: "d", Time: t0.Add(10 * time.Minute), Power: 1200},
+	)
+	// The bucket 12:00-12:15 is incomplete until a sample at or after 12:15.
+	if flushed := in.Flush(t0.Add(15 * time.Minute)); len(flushed) != 0 {
+		t.Fatalf("unexpected flushed buckets %+v", flushed)
+	}
+
+	// A sample straddling the boundary completes it.
+	in.Add(Sample{Device: "d", Time: t0.Add(20 * time.Minute), Power: 1200})
+	flushed := in.Flush(t0.Add(15 * time.Minute))
+	if len(flushed) != 1 || !approx(flushed[0].Energy, 300) {
+		t.Fatalf("unexpected flushed buckets %+v", flushed)
+	}
+
+	// Samples within a flushed bucket are dropped.
+	in.MaxSkew = 30 * time.Minute
+	in.Add(
+		Sample{Device: "d", Time: t0.Add(5 * time.Minute), Power: 1200},
+		Sample{Device: "d", Time: t0.Add(25 * time.Minute), Power: 1200},
+	)
+	buckets := in.Buckets()
+	if len(buckets) != 1 || !approx(buckets[0].Energy, 200) {
+		t.Fatalf("unexpected buckets %+v", buckets)
+	}
+	if stats := in.Stats(); stats.OutOfOrder != 1 || stats.ClockResets != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestGapsAndSkew(t *testing.T) {
+	t0 := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	for _, policy := range []GapPolicy{Interpolate, Drop} {
+		in := New(Hour, nil)
+		in.MaxGap = 10 * time.Minute
+		in.Gap = policy
+		in.Add(
+			Sample{Device: "d", Time: t0, Power: 1200},
+			Sample{Device: "d", Time: t0.Add(5 * time.Minute), Power: 1200},
+			// Out of order and duplicate samples are dropped.
+			Sample{Device: "d", Time: t0.Add(4 * time.Minute), Power: 99999},
+			Sample{Device: "d", Time: t0.Add(5 * time.Minute), Power: 99999},
+			// A 25 minute gap.
+			Sample{Device: "d", Time: t0.Add(30 * time.Minute), Power: 1200},
+			// The clock is reset by an hour.
+			Sample{Device: "d", Time: t0.Add(-30 * time.Minute), Power: 1200},
+			Sample{Device: "d", Time: t0.Add(-25 * time.Minute), Power: 1200},
+		)
+		buckets := in.Buckets()
+		expected := solarmanager.WattHour(600)
+		if policy == Drop {
+			expected = 100
+		}
+		if len(buckets) != 2 || !approx(buckets[0].Energy, 100) || !approx(buckets[1].Energy, expected) {
+			t.Fatalf("policy %d: unexpected buckets %+v", policy, buckets)
+		}
+		stats := in.Stats()
+		if stats != (Stats{Samples: 7, Gaps: 1, OutOfOrder: 2, ClockResets: 1}) {
+			t.Fatalf("policy %d: unexpected stats %+v", policy, stats)
+		}
+	}
+}
+
+func TestClockResetAfterFlush(t *testing.T) {
+	t0 := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	in := New(QuarterHour, nil)
+	in.Add(
+		Sample{Device: "d", Time: t0, Power: 1200},
+		Sample{Device: "d", Time: t0.Add(20 * time.Minute), Power: 1200},
+	)
+	if flushed := in.Flush(t0.Add(15 * time.Minute)); len(flushed) != 1 {
+		t.Fatalf("unexpected flushed buckets %+v", flushed)
+	}
+
+	// The clock is reset to before the flushed bucket. The samples are
+	// integrated from the reset instead of being dropped as late.
+	in.Add(
+		Sample{Device: "d", Time: t0.Add(-time.Hour), Power: 1200},
+		Sample{Device: "d", Time: t0.Add(-50 * time.Minute), Power: 1200},
+	)
+	var energy solarmanager.WattHour
+	for _, b := range in.Buckets() {
+		if b.Start.Before(t0) {
+			energy += b.Energy
+		}
+	}
+	if !approx(energy, 200) {
+		t.Fatalf("unexpected energy %v in %+v", energy, in.Buckets())
+	}
+	if stats := in.Stats(); stats.ClockResets != 1 || stats.Late != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	t0 := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	in := New(Hour, nil)
+	counter := solarmanager.Some[solarmanager.WattHour]
+	in.Add(
+		Sample{Device: "d", Time: t0, Power: 1000, Counter: counter(5000)},
+		// The meter reports 600 Wh instead of the integrated 500 Wh.
+		Sample{Device: "d", Time: t0.Add(30 * time.Minute), Power: 1000, Counter: counter(5600)},
+		// After a reset of the meter, the power is integrated.
+		Sample{Device: "d", Time: t0.Add(45 * time.Minute), Power: 1000, Counter: counter(10)},
+		Sample{Device: "d", Time: t0.Add(90 * time.Minute), Power: 0, Counter: counter(10)},
+	)
+	buckets := in.Buckets()
+	if len(buckets) != 2 || !approx(buckets[0].Energy, 600+250) || !approx(buckets[1].Energy, 0) {
+		t.Fatalf("unexpected buckets %+v", buckets)
+	}
+	if n := in.Stats().CounterResets; n != 1 {
+		t.Fatalf("expected 1 counter reset, got %d", n)
+	}
+}
+
+func TestDaysInTimeZone(t *testing.T) {
+	zurich, err := time.LoadLocation("Europe/Zurich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := New(Day, zurich)
+	// Constant 1 kW from noon before the switch to summer time until noon
+	// after it.
+	start := time.Date(2021, 3, 27, 12, 0, 0, 0, zurich)
+	for ts := start; !ts.After(start.Add(47 * time.Hour)); ts = ts.Add(time.Minute) {
+		in.Add(Sample{Device: "d", Time: ts, Power: 1000})
+	}
+	buckets := in.Buckets()
+	if len(buckets) != 3 {
+		t.Fatalf("unexpected buckets %+v", buckets)
+	}
+	b := buckets[1]
+	if !b.Start.Equal(time.Date(2021, 3, 28, 0, 0, 0, 0, zurich)) || b.End.Sub(b.Start) != 23*time.Hour || !approx(b.Energy, 23000) {
+		t.Fatalf("unexpected bucket %+v", b)
+	}
+	if !approx(buckets[0].Energy, 12000) || !approx(buckets[2].Energy, 12000) {
+		t.Fatalf("unexpected buckets %+v", buckets)
+	}
+
+	// Quarter hours are aligned in zones with offsets that are not whole
+	// hours.
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, e := QuarterHour.bounds(time.Date(2021, 4, 7, 12, 20, 0, 0, kolkata), kolkata)
+	if !s.Equal(time.Date(2021, 4, 7, 12, 15, 0, 0, kolkata)) || e.Sub(s) != 15*time.Minute {
+		t.Fatalf("unexpected bounds %v - %v", s, e)
+	}
+}
+
+func TestGatewaySamples(t *testing.T) {
+	ts := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	samples := GatewaySamples(solarmanager.GatewayData{
+		TimeStamp:           ts,
+		CurrentPvGeneration: 20000,
+		Devices: []solarmanager.SensorData{
+			{Id: "s1", CurrentPower: solarmanager.Some[solarmanager.Watt](3000), CurrentEnergy: solarmanager.Some[solarmanager.WattHour](100)},
+			{Id: "s2"},
+		},
+	})
+	if len(samples) != 4 || samples[0].Device != Production || samples[0].Power != 20000 || samples[3].Device != "s1" || samples[3].Counter.Value != 100 {
+		t.Fatalf("unexpected samples %+v", samples)
+	}
+}
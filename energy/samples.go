@@ -0,0 +1,50 @@
+package energy
+
+import (
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// Device names of the gateway totals in the samples returned by
+// GatewaySamples.
+const (
+	Production  = "production"
+	Consumption = "consumption"
+	// Battery is positive while charging and negative while discharging.
+	Battery = "battery"
+)
+
+// GatewaySamples returns the samples of the live data of a gateway: its
+// totals, named Production, Consumption and Battery, and every device
+// reporting its power, named by sensor ID.
+func GatewaySamples(d solarmanager.GatewayData) []Sample {
+	samples := []Sample{
+		{Device: Production, Time: d.TimeStamp, Power: d.CurrentPvGeneration},
+		{Device: Consumption, Time: d.TimeStamp, Power: d.CurrentPowerConsumption},
+		{Device: Battery, Time: d.TimeStamp, Power: d.CurrentBatteryChargeDischarge},
+	}
+	for _, dev := range d.Devices {
+		if dev.CurrentPower.Set {
+			samples = append(samples, Sample{
+				Device:  dev.Id,
+				Time:    d.TimeStamp,
+				Power:   dev.CurrentPower.Value,
+				Counter: dev.CurrentEnergy,
+			})
+		}
+	}
+	return samples
+}
+
+// SensorSample returns the sample of the live data of a sensor. It returns
+// false if the sensor doesn't report its power.
+func SensorSample(r solarmanager.GetSensorDataResponse) (Sample, bool) {
+	if !r.Data.CurrentPower.Set {
+		return Sample{}, false
+	}
+	return Sample{
+		Device:  r.Data.Id,
+		Time:    r.Date,
+		Power:   r.Data.CurrentPower.Value,
+		Counter: r.Data.CurrentEnergy,
+	}, true
+}
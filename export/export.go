@@ -0,0 +1,199 @@
+// Package export writes SolarManager statistics and forecasts as CSV or
+// JSON Lines. Rows are written as they are passed in, so long exports can be
+// produced period by period without holding the whole history in memory.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// Exporter is implemented by CSVWriter and JSONLinesWriter.
+type Exporter interface {
+	WriteGatewayConsumption(s solarmanager.GetGatewayConsumptionStatisticsResponse) error
+	WriteSensorConsumption(s solarmanager.GetSensorConsumptionStatisticsResponse) error
+	WriteForecast(f solarmanager.GetGatewayForecastResponse) error
+	Flush() error
+}
+
+// ErrMixedRows is returned when different kinds of rows are written to the
+// same CSVWriter, which would result in a file with inconsistent columns.
+var ErrMixedRows = errors.New("export: cannot mix different row kinds in one CSV file")
+
+const (
+	kindGatewayConsumption = "gateway consumption"
+	kindSensorConsumption  = "sensor consumption"
+	kindForecast           = "forecast"
+)
+
+// CSVOptions configures a CSVWriter.
+type CSVOptions struct {
+	// Comma is the field delimiter. If zero, ',' is used.
+	Comma rune
+	// DecimalComma formats numbers with a decimal comma instead of a point.
+	DecimalComma bool
+	// Location is used to format forecast timestamps. If nil, time.UTC is used.
+	Location *time.Location
+}
+
+// SwissCSV are CSV options suitable for spreadsheets using the Swiss German
+// locale.
+var SwissCSV = CSVOptions{Comma: ';', DecimalComma: true}
+
+// CSVWriter writes statistics and forecasts as CSV. A header row including the
+// units is written before the first row.
+type CSVWriter struct {
+	w    *csv.Writer
+	opts CSVOptions
+	kind string
+}
+
+// NewCSVWriter returns a new CSVWriter writing to w.
+func NewCSVWriter(w io.Writer, opts CSVOptions) *CSVWriter {
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	return &CSVWriter{w: cw, opts: opts}
+}
+
+func (w *CSVWriter) header(kind string, columns ...string) error {
+	if w.kind == kind {
+		return nil
+	}
+	if w.kind != "" {
+		return ErrMixedRows
+	}
+	w.kind = kind
+	return w.w.Write(columns)
+}
+
+func (w *CSVWriter) float(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if w.opts.DecimalComma {
+		s = strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
+
+// WriteGatewayConsumption writes one row per statistics bucket.
+func (w *CSVWriter) WriteGatewayConsumption(s solarmanager.GetGatewayConsumptionStatisticsResponse) error {
+	if err := w.header(kindGatewayConsumption, "gateway_id", "period", "date", "consumption [Wh]", "production [Wh]"); err != nil {
+		return err
+	}
+	for _, d := range s.Data {
+		err := w.w.Write([]string{s.GatewayId, s.Period, d.CreatedAt, w.float(float64(d.Consumption)), w.float(float64(d.Production))})
+		if err != nil {
+			return err
+		}
+	}
+	return w.w.Error()
+}
+
+// WriteSensorConsumption writes one row per statistics bucket.
+func (w *CSVWriter) WriteSensorConsumption(s solarmanager.GetSensorConsumptionStatisticsResponse) error {
+	if err := w.header(kindSensorConsumption, "sensor_id", "period", "date", "consumption [Wh]"); err != nil {
+		return err
+	}
+	for _, d := range s.Data {
+		if err := w.w.Write([]string{s.SensorId, s.Period, d.CreatedAt, w.float(float64(d.Consumption))}); err != nil {
+			return err
+		}
+	}
+	return w.w.Error()
+}
+
+// WriteForecast writes one row per forecast entry.
+func (w *CSVWriter) WriteForecast(f solarmanager.GetGatewayForecastResponse) error {
+	if err := w.header(kindForecast, "timestamp", "expected [W]", "min [W]", "max [W]"); err != nil {
+		return err
+	}
+	for _, e := range f {
+		ts := time.UnixMilli(e.Timestamp).In(w.opts.Location).Format(time.RFC3339)
+		err := w.w.Write([]string{ts, w.float(float64(e.Expected)), w.float(float64(e.Min)), w.float(float64(e.Max))})
+		if err != nil {
+			return err
+		}
+	}
+	return w.w.Error()
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *CSVWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// JSONLinesWriter writes statistics and forecasts as JSON Lines, one JSON
+// object per bucket or forecast entry.
+type JSONLinesWriter struct {
+	enc *json.Encoder
+}
+
+// NewJSONLinesWriter returns a new JSONLinesWriter writing to w.
+func NewJSONLinesWriter(w io.Writer) *JSONLinesWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONLinesWriter{enc: enc}
+}
+
+type gatewayConsumptionRow struct {
+	GatewayId   string                `json:"gatewayId"`
+	Period      string                `json:"period"`
+	CreatedAt   string                `json:"createdAt"`
+	Consumption solarmanager.WattHour `json:"consumption"`
+	Production  solarmanager.WattHour `json:"production"`
+}
+
+type sensorConsumptionRow struct {
+	SensorId    string                `json:"sensorId"`
+	Period      string                `json:"period"`
+	CreatedAt   string                `json:"createdAt"`
+	Consumption solarmanager.WattHour `json:"consumption"`
+}
+
+// WriteGatewayConsumption writes one line per statistics bucket.
+func (w *JSONLinesWriter) WriteGatewayConsumption(s solarmanager.GetGatewayConsumptionStatisticsResponse) error {
+	for _, d := range s.Data {
+		err := w.enc.Encode(gatewayConsumptionRow{s.GatewayId, s.Period, d.CreatedAt, d.Consumption, d.Production})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSensorConsumption writes one line per statistics bucket.
+func (w *JSONLinesWriter) WriteSensorConsumption(s solarmanager.GetSensorConsumptionStatisticsResponse) error {
+	for _, d := range s.Data {
+		if err := w.enc.Encode(sensorConsumptionRow{s.SensorId, s.Period, d.CreatedAt, d.Consumption}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteForecast writes one line per forecast entry.
+func (w *JSONLinesWriter) WriteForecast(f solarmanager.GetGatewayForecastResponse) error {
+	for _, e := range f {
+		if err := w.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush is a no-op, as lines are written immediately.
+func (w *JSONLinesWriter) Flush() error {
+	return nil
+}
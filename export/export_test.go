@@ -0,0 +1,124 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+func gatewayStatistics(t *testing.T) solarmanager.GetGatewayConsumptionStatisticsResponse {
+	t.Helper()
+	var s solarmanager.GetGatewayConsumptionStatisticsResponse
+	err := json.Unmarshal([]byte(`{
+	"gatewayId": "5c8fb8e7cdcda169da9d5fe3",
+	"period": "day",
+	"data": [
+		{"createdAt": "2021-04-13", "consumption": 1200, "production": 3400},
+		{"createdAt": "2021-04-14", "consumption": 900, "production": 0}
+	],
+	"totalConsumption": 2100
+}`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func sensorStatistics(t *testing.T) solarmanager.GetSensorConsumptionStatisticsResponse {
+	t.Helper()
+	var s solarmanager.GetSensorConsumptionStatisticsResponse
+	err := json.Unmarshal([]byte(`{
+	"sensorId": "5da6fdbf6f9aab5013a5cb9f",
+	"period": "day",
+	"data": [{"createdAt": "2021-01-01", "consumption": 120.5}],
+	"totalConsumption": 120.5
+}`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCSVGatewayConsumption(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, CSVOptions{})
+	s := gatewayStatistics(t)
+	if err := w.WriteGatewayConsumption(s); err != nil {
+		t.Fatal(err)
+	}
+	// A second batch must not repeat the header.
+	s.Data = s.Data[:1]
+	if err := w.WriteGatewayConsumption(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "gateway_id,period,date,consumption [Wh],production [Wh]\n" +
+		"5c8fb8e7cdcda169da9d5fe3,day,2021-04-13,1200,3400\n" +
+		"5c8fb8e7cdcda169da9d5fe3,day,2021-04-14,900,0\n" +
+		"5c8fb8e7cdcda169da9d5fe3,day,2021-04-13,1200,3400\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected CSV, expected %q, but got %q", expected, buf.String())
+	}
+
+	if err := w.WriteSensorConsumption(sensorStatistics(t)); err != ErrMixedRows {
+		t.Fatalf("unexpected error, expected %v, but got %v", ErrMixedRows, err)
+	}
+}
+
+func TestCSVSwissLocale(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, SwissCSV)
+	if err := w.WriteSensorConsumption(sensorStatistics(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "sensor_id;period;date;consumption [Wh]\n5da6fdbf6f9aab5013a5cb9f;day;2021-01-01;120,5\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected CSV, expected %q, but got %q", expected, buf.String())
+	}
+}
+
+func TestCSVForecast(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, CSVOptions{Location: time.FixedZone("CET", 3600)})
+	f := solarmanager.GetGatewayForecastResponse{{Timestamp: 1641808800000, Expected: 1726, Min: 1183, Max: 2269}}
+	if err := w.WriteForecast(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "timestamp,expected [W],min [W],max [W]\n2022-01-10T11:00:00+01:00,1726,1183,2269\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected CSV, expected %q, but got %q", expected, buf.String())
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJSONLinesWriter(&buf)
+	if err := w.WriteGatewayConsumption(gatewayStatistics(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSensorConsumption(sensorStatistics(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"gatewayId":"5c8fb8e7cdcda169da9d5fe3","period":"day","createdAt":"2021-04-13","consumption":1200,"production":3400}
+{"gatewayId":"5c8fb8e7cdcda169da9d5fe3","period":"day","createdAt":"2021-04-14","consumption":900,"production":0}
+{"sensorId":"5da6fdbf6f9aab5013a5cb9f","period":"day","createdAt":"2021-01-01","consumption":120.5}
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected JSON lines, expected %q, but got %q", expected, buf.String())
+	}
+}
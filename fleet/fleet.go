@@ -0,0 +1,157 @@
+// Package fleet runs SolarManager API queries across many gateways, e.g. all
+// installations managed by an installer, and summarizes their state.
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// DefaultConcurrency is the number of gateways queried at a time if
+// Fleet.Concurrency is 0.
+const DefaultConcurrency = 8
+
+// Gateway is a gateway of the fleet together with the client used to query
+// it. Gateways of different accounts use different clients.
+type Gateway struct {
+	SmID   string
+	Client solarmanager.API
+}
+
+// GatewayError reports a failed query of a single gateway.
+type GatewayError struct {
+	SmID string
+	Err  error
+}
+
+func (e *GatewayError) Error() string {
+	return fmt.Sprintf("gateway %s: %v", e.SmID, e.Err)
+}
+
+func (e *GatewayError) Unwrap() error {
+	return e.Err
+}
+
+// Fleet is a set of gateways. It is safe for concurrent use.
+type Fleet struct {
+	// Concurrency is the maximum number of gateways queried at a time.
+	Concurrency int
+
+	mu       sync.Mutex
+	gateways []Gateway
+}
+
+// New returns a fleet of the given gateways.
+func New(gateways ...Gateway) *Fleet {
+	f := &Fleet{}
+	f.Add(gateways...)
+	return f
+}
+
+// Add adds gateways to the fleet. Gateways whose SmID is already part of the
+// fleet replace the existing entry.
+func (f *Fleet) Add(gateways ...Gateway) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+outer:
+	for _, g := range gateways {
+		for i := range f.gateways {
+			if f.gateways[i].SmID == g.SmID {
+				f.gateways[i] = g
+				continue outer
+			}
+		}
+		f.gateways = append(f.gateways, g)
+	}
+}
+
+// AddClient adds the gateways with the given IDs, all queried with client.
+func (f *Fleet) AddClient(client solarmanager.API, smIDs ...string) {
+	gateways := make([]Gateway, len(smIDs))
+	for i, id := range smIDs {
+		gateways[i] = Gateway{SmID: id, Client: client}
+	}
+	f.Add(gateways...)
+}
+
+// Gateways returns the gateways of the fleet in the order they were added.
+func (f *Fleet) Gateways() []Gateway {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Gateway(nil), f.gateways...)
+}
+
+// Run calls fn for every gateway, for at most Concurrency gateways at a time.
+// Failures are returned as a join of *GatewayError, sorted by SmID. If ctx is
+// done, no further calls are started and its error is included.
+func (f *Fleet) Run(ctx context.Context, fn func(ctx context.Context, g Gateway) error) error {
+	gateways := f.Gateways()
+	concurrency := f.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []*GatewayError
+	)
+	sem := make(chan struct{}, concurrency)
+loop:
+	for _, g := range gateways {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		wg.Add(1)
+		go func(g Gateway) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(ctx, g); err != nil {
+				mu.Lock()
+				errs = append(errs, &GatewayError{SmID: g.SmID, Err: err})
+				mu.Unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].SmID < errs[j].SmID })
+	joined := make([]error, 0, len(errs)+1)
+	for _, err := range errs {
+		joined = append(joined, err)
+	}
+	if err := ctx.Err(); err != nil {
+		joined = append(joined, err)
+	}
+	return errors.Join(joined...)
+}
+
+// Query calls fn for every gateway of f like Run and returns the results
+// keyed by SmID. Results of failed gateways are omitted.
+func Query[T any](ctx context.Context, f *Fleet, fn func(ctx context.Context, g Gateway) (T, error)) (map[string]T, error) {
+	var mu sync.Mutex
+	results := make(map[string]T)
+	err := f.Run(ctx, func(ctx context.Context, g Gateway) error {
+		v, err := fn(ctx, g)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		results[g.SmID] = v
+		mu.Unlock()
+		return nil
+	})
+	return results, err
+}
@@ -0,0 +1,103 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+	"github.com/ingmarstein/solarmanager-go/solarmanagertest"
+)
+
+func TestReport(t *testing.T) {
+	now := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+
+	installer := solarmanagertest.NewServer("installer", "secret")
+	defer installer.Close()
+	for _, id := range []string{"sm1", "sm2", "sm3"} {
+		installer.AddGateway(solarmanagertest.NewGateway(id))
+	}
+	installer.UpdateGateway("sm2", func(g *solarmanagertest.Gateway) {
+		g.Info.Gateway.Signal = "not connected"
+		g.Info.Gateway.Firmware = "0.19.0"
+		g.Info.Gateway.LastErrorDate = now.Add(-time.Hour)
+	})
+	installer.UpdateGateway("sm3", func(g *solarmanagertest.Gateway) {
+		g.Info.Gateway.LastErrorDate = now.Add(-48 * time.Hour)
+	})
+	installer.Fail("/v1/stream/gateway/sm3", http.StatusBadGateway, 0)
+
+	owner := solarmanagertest.NewServer("owner", "secret")
+	defer owner.Close()
+	owner.AddGateway(solarmanagertest.NewGateway("sm4"))
+
+	f := New()
+	f.AddClient(installer.NewClient(), "sm1", "sm2", "sm3")
+	f.Add(Gateway{SmID: "sm4", Client: owner.NewClient()})
+
+	r, err := f.Report(context.Background(), now)
+	var gwErr *GatewayError
+	if !errors.As(err, &gwErr) || gwErr.SmID != "sm3" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := &Report{
+		Time:         now,
+		Gateways:     4,
+		Offline:      []string{"sm2"},
+		Firmware:     map[string][]string{"0.20.1": {"sm1", "sm4"}, "0.19.0": {"sm2"}},
+		RecentErrors: []string{"sm2"},
+		Failed:       []string{"sm3"},
+		Production:   3 * 20000,
+		Consumption:  3 * 5000,
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Fatalf("unexpected report\n%+v\nexpected\n%+v", r, expected)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	var active, maxActive atomic.Int32
+	fake := &solarmanagertest.Fake{
+		GetGatewayForecastFunc: func(smID string) (solarmanager.GetGatewayForecastResponse, error) {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for m := maxActive.Load(); n > m && !maxActive.CompareAndSwap(m, n); m = maxActive.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			if smID == "bad" {
+				return nil, errors.New("boom")
+			}
+			return solarmanager.GetGatewayForecastResponse{{Expected: 1000}}, nil
+		},
+	}
+	f := New()
+	f.Concurrency = 2
+	f.AddClient(fake, "a", "b", "bad", "c", "d")
+	f.AddClient(fake, "a")
+	if n := len(f.Gateways()); n != 5 {
+		t.Fatalf("expected duplicate gateway to be replaced, got %d gateways", n)
+	}
+
+	results, err := Query(context.Background(), f, func(ctx context.Context, g Gateway) (solarmanager.GetGatewayForecastResponse, error) {
+		return g.Client.GetGatewayForecast(g.SmID)
+	})
+	if len(results) != 4 || results["c"][0].Expected != 1000 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if err == nil || err.Error() != "gateway bad: boom" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := maxActive.Load(); n != 2 {
+		t.Fatalf("expected 2 concurrent queries, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := f.Run(ctx, func(context.Context, Gateway) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+}
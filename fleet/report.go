@@ -0,0 +1,81 @@
+package fleet
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// RecentErrorWindow is how far back Report looks for gateway errors.
+const RecentErrorWindow = 24 * time.Hour
+
+// Report summarizes the state of a fleet. Lists of gateway IDs are sorted.
+type Report struct {
+	Time     time.Time
+	Gateways int // number of gateways in the fleet, including failed ones
+
+	// Offline lists the gateways whose signal is not "connected".
+	Offline []string
+	// Firmware maps firmware versions to the gateways running them.
+	Firmware map[string][]string
+	// RecentErrors lists the gateways with an error in the
+	// RecentErrorWindow before Time.
+	RecentErrors []string
+	// Failed lists the gateways that couldn't be queried. They are not
+	// included in any other field.
+	Failed []string
+
+	// Production, Consumption and BatteryChargeDischarge are the sums of
+	// the live data of all gateways.
+	Production             solarmanager.Watt
+	Consumption            solarmanager.Watt
+	BatteryChargeDischarge solarmanager.Watt
+}
+
+// Report queries the info and live data of all gateways and summarizes them.
+// now is the reference time for recent errors. The report is returned even
+// if some gateways fail, together with an error as returned by Run.
+func (f *Fleet) Report(ctx context.Context, now time.Time) (*Report, error) {
+	r := &Report{
+		Time:     now,
+		Gateways: len(f.Gateways()),
+		Firmware: make(map[string][]string),
+	}
+	var mu sync.Mutex
+	err := f.Run(ctx, func(ctx context.Context, g Gateway) error {
+		info, err := g.Client.GetGatewayInfoContext(ctx, g.SmID)
+		var data solarmanager.GetGatewayDataResponse
+		if err == nil {
+			data, err = g.Client.GetGatewayDataContext(ctx, g.SmID)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			r.Failed = append(r.Failed, g.SmID)
+			return err
+		}
+		if info.Gateway.Signal != "connected" {
+			r.Offline = append(r.Offline, g.SmID)
+		}
+		r.Firmware[info.Gateway.Firmware] = append(r.Firmware[info.Gateway.Firmware], g.SmID)
+		if last := info.Gateway.LastErrorDate; !last.IsZero() && !last.After(now) && now.Sub(last) <= RecentErrorWindow {
+			r.RecentErrors = append(r.RecentErrors, g.SmID)
+		}
+		r.Production += data.CurrentPvGeneration
+		r.Consumption += data.CurrentPowerConsumption
+		r.BatteryChargeDischarge += data.CurrentBatteryChargeDischarge
+		return nil
+	})
+
+	sort.Strings(r.Offline)
+	sort.Strings(r.RecentErrors)
+	sort.Strings(r.Failed)
+	for _, ids := range r.Firmware {
+		sort.Strings(ids)
+	}
+	return r, err
+}
@@ -0,0 +1,290 @@
+// Package httpcache provides a caching http.RoundTripper for the SolarManager
+// API. Responses are cached according to their Cache-Control and Expires
+// headers, falling back to per-endpoint TTLs for endpoints whose data rarely
+// changes, and are revalidated using ETag and Last-Modified when stale:
+//
+//	t := httpcache.NewTransport(nil, nil)
+//	client := solarmanager.NewClient(&http.Client{Transport: t}, nil, username, password)
+//	// ...
+//	log.Printf("cache hit ratio: %.2f", t.Stats().HitRatio())
+package httpcache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// XFromCache is set on responses served from the cache, including
+// revalidated ones.
+const XFromCache = "X-From-Cache"
+
+// Entry is a cached response.
+type Entry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Expires    time.Time // the entry must be revalidated after this time
+}
+
+// Backend stores cache entries. Implementations must be safe for concurrent
+// use and must not modify stored entries.
+type Backend interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	Delete(key string)
+}
+
+// DefaultTTLs are the TTLs used for responses without caching headers, keyed
+// by path prefix.
+var DefaultTTLs = map[string]time.Duration{
+	"/v1/info/gateway/":             time.Hour,
+	"/v1/info/sensors/":             15 * time.Minute,
+	"/v1/info/sensor/":              15 * time.Minute,
+	"/v1/forecast/gateways/":        time.Hour,
+	"/v1/low-rate-tariff/gateways/": 24 * time.Hour,
+}
+
+// Stats are the cache counters of a Transport.
+type Stats struct {
+	Hits        uint64 // responses served from the cache without a request
+	Revalidated uint64 // responses served from the cache after a 304
+	Misses      uint64 // responses fetched from the server
+}
+
+// HitRatio returns the fraction of responses served from the cache.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Revalidated + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.Revalidated) / float64(total)
+}
+
+// Transport is an http.RoundTripper caching the responses of GET requests.
+// Responses are cached per URL and credentials, so clients with different
+// accounts can share a Backend.
+type Transport struct {
+	// Key is the HMAC key the credentials are hashed with in cache keys, so
+	// that the entries of a Backend can't be attributed to credentials
+	// without it. NewTransport initializes it randomly. Transports sharing a
+	// persistent Backend must use the same secret Key to share its entries.
+	Key []byte
+	// TTLs are the TTLs for responses without Cache-Control or Expires
+	// headers, keyed by path prefix. Responses of other paths are only
+	// cached if they carry validators, and are then always revalidated.
+	TTLs map[string]time.Duration
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+
+	transport http.RoundTripper
+	backend   Backend
+
+	hits, revalidated, misses atomic.Uint64
+}
+
+// NewTransport returns a Transport using transport, or http.DefaultTransport
+// if nil, and backend, or a 1000 entry LRU if nil. TTLs is initialized with
+// a copy of DefaultTTLs.
+func NewTransport(transport http.RoundTripper, backend Backend) *Transport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if backend == nil {
+		backend = NewLRU(1000)
+	}
+	ttls := make(map[string]time.Duration, len(DefaultTTLs))
+	for k, v := range DefaultTTLs {
+		ttls[k] = v
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("httpcache: " + err.Error())
+	}
+	return &Transport{Key: key, TTLs: ttls, Now: time.Now, transport: transport, backend: backend}
+}
+
+// Stats returns the current cache counters.
+func (t *Transport) Stats() Stats {
+	return Stats{Hits: t.hits.Load(), Revalidated: t.revalidated.Load(), Misses: t.misses.Load()}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqCC := parseCacheControl(req.Header)
+	if req.Method != http.MethodGet || reqCC.has("no-store") ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.transport.RoundTrip(req)
+	}
+
+	key := t.cacheKey(req)
+	entry, ok := t.backend.Get(key)
+	if ok && !reqCC.has("no-cache") && t.Now().Before(entry.Expires) {
+		t.hits.Add(1)
+		return entry.response(req), nil
+	}
+
+	outreq := req
+	if ok {
+		etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outreq = req.Clone(req.Context())
+			if etag != "" {
+				outreq.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outreq.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+
+	resp, err := t.transport.RoundTrip(outreq)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && outreq != req && resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		updated := *entry
+		updated.Header = entry.Header.Clone()
+		for _, h := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+			if v := resp.Header.Get(h); v != "" {
+				updated.Header.Set(h, v)
+			}
+		}
+		ttl, _ := t.freshness(req, updated.Header)
+		updated.Expires = t.Now().Add(ttl)
+		t.backend.Set(key, &updated)
+		t.revalidated.Add(1)
+		return updated.response(req), nil
+	}
+
+	t.misses.Add(1)
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	ttl, store := t.freshness(req, resp.Header)
+	if !store {
+		t.backend.Delete(key)
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	t.backend.Set(key, &Entry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		Expires:    t.Now().Add(ttl),
+	})
+	return resp, nil
+}
+
+// freshness returns how long a response with the given header is fresh and
+// whether it may be stored at all.
+func (t *Transport) freshness(req *http.Request, header http.Header) (time.Duration, bool) {
+	validators := header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+	cc := parseCacheControl(header)
+	switch {
+	case cc.has("no-store"):
+		return 0, false
+	case cc.has("no-cache"):
+		return 0, validators
+	case cc.has("max-age"):
+		maxAge, err := strconv.Atoi(cc["max-age"])
+		if err != nil {
+			return 0, validators
+		}
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return time.Duration(maxAge-age) * time.Second, true
+	case header.Get("Expires") != "":
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err != nil {
+			// Invalid dates such as "0" mean already expired.
+			return 0, validators
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = t.Now()
+		}
+		return expires.Sub(date), true
+	}
+	if ttl := t.ttl(req.URL.Path); ttl > 0 {
+		return ttl, true
+	}
+	return 0, validators
+}
+
+// ttl returns the TTL of the longest prefix in TTLs found in path. Prefixes
+// are matched anywhere in the path, so that base URLs with a path work.
+func (t *Transport) ttl(path string) time.Duration {
+	var ttl time.Duration
+	longest := -1
+	for prefix, d := range t.TTLs {
+		if len(prefix) > longest && strings.Contains(path, prefix) {
+			ttl, longest = d, len(prefix)
+		}
+	}
+	return ttl
+}
+
+// cacheKey returns the key of req's URL and credentials. Credentials are
+// hashed with Key to keep them out of the backend.
+func (t *Transport) cacheKey(req *http.Request) string {
+	key := req.URL.String()
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		mac := hmac.New(sha256.New, t.Key)
+		mac.Write([]byte(auth))
+		key += " " + hex.EncodeToString(mac.Sum(nil))
+	}
+	return key
+}
+
+func (e *Entry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Set(XFromCache, "1")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
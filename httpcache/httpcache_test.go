@@ -0,0 +1,220 @@
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+func get(t *testing.T, c *http.Client, rawURL, auth string) (string, *http.Response) {
+	t.Helper()
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), resp
+}
+
+func TestDefaultTTL(t *testing.T) {
+	var requests atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"gateway": {"sm_id": "sm1"}}`))
+	}))
+	defer svr.Close()
+
+	now := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	tr := NewTransport(nil, nil)
+	tr.Now = func() time.Time { return now }
+	baseURL, err := url.Parse(svr.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := solarmanager.NewClient(&http.Client{Transport: tr}, baseURL, "user", "secret")
+
+	for i := 0; i < 3; i++ {
+		info, err := client.GetGatewayInfo("sm1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Gateway.SmId != "sm1" {
+			t.Fatalf("unexpected response %+v", info)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+
+	// Live data has no default TTL.
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetGatewayData("sm1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(time.Hour)
+	if _, err := client.GetGatewayInfo("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 4 {
+		t.Fatalf("expected 4 requests, got %d", n)
+	}
+	stats := tr.Stats()
+	if stats.Hits != 2 || stats.Misses != 4 || stats.HitRatio() != 2.0/6 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRevalidation(t *testing.T) {
+	var requests, notModified atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("data"))
+	}))
+	defer svr.Close()
+
+	tr := NewTransport(nil, nil)
+	c := &http.Client{Transport: tr}
+	for i := 0; i < 3; i++ {
+		body, resp := get(t, c, svr.URL+"/v1/stream/gateway/sm1", "")
+		if body != "data" || resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+		}
+		if fromCache := resp.Header.Get(XFromCache) == "1"; fromCache != (i > 0) {
+			t.Fatalf("unexpected %s header in response %d", XFromCache, i)
+		}
+	}
+	if requests.Load() != 3 || notModified.Load() != 2 {
+		t.Fatalf("expected 3 requests of which 2 conditional, got %d and %d", requests.Load(), notModified.Load())
+	}
+	if stats := tr.Stats(); stats.Revalidated != 2 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	var requests atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/v1/info/gateway/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/expires":
+			w.Header().Set("Date", "Wed, 07 Apr 2021 12:00:00 GMT")
+			w.Header().Set("Expires", "Wed, 07 Apr 2021 12:01:00 GMT")
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer svr.Close()
+
+	now := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	tr := NewTransport(nil, nil)
+	tr.Now = func() time.Time { return now }
+	c := &http.Client{Transport: tr}
+
+	for _, path := range []string{"/max-age", "/expires"} {
+		requests.Store(0)
+		get(t, c, svr.URL+path, "a")
+		get(t, c, svr.URL+path, "a")
+		if body, _ := get(t, c, svr.URL+path, "b"); body != "b" {
+			t.Fatalf("%s: response of other credentials served: %q", path, body)
+		}
+		if n := requests.Load(); n != 2 {
+			t.Fatalf("%s: expected 2 requests, got %d", path, n)
+		}
+	}
+
+	requests.Store(0)
+	get(t, c, svr.URL+"/v1/info/gateway/no-store", "")
+	get(t, c, svr.URL+"/v1/info/gateway/no-store", "")
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("no-store: expected 2 requests, got %d", n)
+	}
+
+	now = now.Add(time.Minute)
+	requests.Store(0)
+	get(t, c, svr.URL+"/max-age", "a")
+	get(t, c, svr.URL+"/expires", "a")
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected expired entries to be refetched, got %d requests", n)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	var requests atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer svr.Close()
+
+	backend := NewLRU(10)
+	a, b := NewTransport(nil, backend), NewTransport(nil, backend)
+	if bytes.Equal(a.Key, b.Key) {
+		t.Fatal("transports share a random key")
+	}
+	get(t, &http.Client{Transport: a}, svr.URL, "secret")
+	get(t, &http.Client{Transport: b}, svr.URL, "secret")
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("entry shared across keys, got %d requests", n)
+	}
+
+	b.Key = a.Key
+	if _, resp := get(t, &http.Client{Transport: b}, svr.URL, "secret"); resp.Header.Get(XFromCache) == "" {
+		t.Fatal("entry not shared with the same key")
+	}
+
+	sum := sha256.Sum256([]byte("secret"))
+	if _, ok := backend.Get(svr.URL + " " + hex.EncodeToString(sum[:])); ok {
+		t.Fatal("credentials hashed without a key")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", &Entry{Body: []byte("a")})
+	c.Set("b", &Entry{Body: []byte("b")})
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("missing entry a")
+	}
+	c.Set("c", &Entry{Body: []byte("c")})
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("least recently used entry b not evicted")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("unexpected length %d", c.Len())
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok || c.Len() != 1 {
+		t.Fatal("entry a not deleted")
+	}
+}
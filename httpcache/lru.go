@@ -0,0 +1,77 @@
+package httpcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is an in-memory Backend that evicts the least recently used entry
+// once it holds MaxEntries entries. It is safe for concurrent use.
+type LRU struct {
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewLRU returns an LRU holding at most maxEntries entries, or an unlimited
+// number if maxEntries is 0.
+func NewLRU(maxEntries int) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get implements Backend.
+func (c *LRU) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruItem).entry, true
+}
+
+// Set implements Backend.
+func (c *LRU) Set(key string, entry *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruItem).entry = entry
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruItem{key, entry})
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+// Delete implements Backend.
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// Len returns the number of entries.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,312 @@
+// Package influx converts SolarManager API responses into InfluxDB line
+// protocol points and writes them to an InfluxDB compatible HTTP endpoint
+// such as InfluxDB or VictoriaMetrics.
+package influx
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// Measurement names used for the generated points.
+const (
+	MeasurementGateway     = "solarmanager_gateway"
+	MeasurementDevice      = "solarmanager_device"
+	MeasurementConsumption = "solarmanager_consumption"
+	MeasurementForecast    = "solarmanager_forecast"
+)
+
+// Tag keys used for the generated points.
+const (
+	TagSmID        = "sm_id"
+	TagSensorID    = "sensor_id"
+	TagType        = "type"
+	TagDeviceGroup = "device_group"
+	TagPeriod      = "period"
+)
+
+// Point is a single line protocol data point.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// String returns the point encoded in line protocol with nanosecond precision,
+// without a trailing newline.
+func (p Point) String() string {
+	var b strings.Builder
+	p.writeTo(&b)
+	return b.String()
+}
+
+func (p Point) writeTo(b *strings.Builder) {
+	b.WriteString(escape(p.Measurement, ", "))
+
+	tagKeys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		// Influx rejects empty tag values, so drop them instead.
+		if v != "" {
+			tagKeys = append(tagKeys, k)
+		}
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		b.WriteByte(',')
+		b.WriteString(escape(k, ",= "))
+		b.WriteByte('=')
+		b.WriteString(escape(p.Tags[k], ",= "))
+	}
+
+	fieldKeys := make([]string, 0, len(p.Fields))
+	for k := range p.Fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	for i, k := range fieldKeys {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(escape(k, ",= "))
+		b.WriteByte('=')
+		b.WriteString(formatField(p.Fields[k]))
+	}
+
+	if !p.Time.IsZero() {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(p.Time.UnixNano(), 10))
+	}
+}
+
+func escape(s, chars string) string {
+	if !strings.ContainsAny(s, chars+"\\") {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func formatField(v interface{}) string {
+	switch v := v.(type) {
+	case int:
+		return strconv.FormatInt(int64(v), 10) + "i"
+	case int64:
+		return strconv.FormatInt(v, 10) + "i"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	default:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(fmt.Sprint(v)) + `"`
+	}
+}
+
+// Converter turns SolarManager API responses of a single gateway into points.
+type Converter struct {
+	// SmID is the SolarManager ID added as sm_id tag to every point.
+	SmID string
+	// Sensors is used to add type and device_group tags to device points.
+	// It is keyed by SensorInfo.Id.
+	Sensors map[string]solarmanager.SensorInfo
+	// Location is used to interpret statistics dates, which carry no time
+	// zone. If nil, time.UTC is used.
+	Location *time.Location
+}
+
+// NewConverter returns a Converter for the given gateway, labelling device
+// points with the supplied sensor metadata.
+func NewConverter(smID string, sensors []solarmanager.SensorInfo) *Converter {
+	c := &Converter{
+		SmID:    smID,
+		Sensors: make(map[string]solarmanager.SensorInfo, len(sensors)),
+	}
+	for _, s := range sensors {
+		c.Sensors[s.Id] = s
+	}
+	return c
+}
+
+func (c *Converter) deviceTags(sensorID string) map[string]string {
+	tags := map[string]string{
+		TagSmID:     c.SmID,
+		TagSensorID: sensorID,
+	}
+	if s, ok := c.Sensors[sensorID]; ok {
+		tags[TagType] = s.Type
+		tags[TagDeviceGroup] = s.DeviceGroup
+	}
+	return tags
+}
+
+// addExtraFields adds numeric members not modelled by the solarmanager types
+// as float fields under their API name, so new metrics are forwarded without
+// waiting for a release.
+func addExtraFields(fields map[string]interface{}, extra map[string]json.RawMessage) map[string]interface{} {
+	for k, raw := range extra {
+		var f float64
+		if _, ok := fields[k]; !ok && json.Unmarshal(raw, &f) == nil {
+			fields[k] = f
+		}
+	}
+	return fields
+}
+
+func deviceFields(d solarmanager.SensorData) map[string]interface{} {
+	fields := map[string]interface{}{
+		"signal":                  d.Signal,
+		"accumulated_error_count": d.AccumulatedErrorCount,
+		"error_count":             len(d.Errors),
+	}
+	// Values a device doesn't report are left out rather than written as 0.
+	for k, v := range map[string]solarmanager.Optional[solarmanager.Watt]{
+		"current_power_inv_sm": d.CurrentPowerInvSm,
+		"current_power":        d.CurrentPower,
+	} {
+		if v.Set {
+			fields[k] = float64(v.Value)
+		}
+	}
+	if v, ok := d.CurrentEnergy.Get(); ok {
+		fields["current_energy"] = float64(v)
+	}
+	for k, v := range map[string]solarmanager.Optional[int]{
+		"active_device":      d.ActiveDevice,
+		"switch_state":       d.SwitchState,
+		"current_water_temp": d.CurrentWaterTemp,
+		"status":             d.Status,
+		"soc":                d.SOC,
+	} {
+		if v.Set {
+			fields[k] = v.Value
+		}
+	}
+	return addExtraFields(fields, d.Extra)
+}
+
+// GatewayData converts a live gateway snapshot into one gateway point and one
+// device point per entry in Devices.
+func (c *Converter) GatewayData(d solarmanager.GetGatewayDataResponse) []Point {
+	points := make([]Point, 0, 1+len(d.Devices))
+	points = append(points, Point{
+		Measurement: MeasurementGateway,
+		Tags:        map[string]string{TagSmID: c.SmID},
+		Fields: addExtraFields(map[string]interface{}{
+			"current_battery_charge_discharge": float64(d.CurrentBatteryChargeDischarge),
+			"current_power_consumption":        float64(d.CurrentPowerConsumption),
+			"current_pv_generation":            float64(d.CurrentPvGeneration),
+			"soc":                              d.Soc,
+			"error_count":                      len(d.Errors),
+		}, d.Extra),
+		Time: d.TimeStamp,
+	})
+	for _, dev := range d.Devices {
+		points = append(points, Point{
+			Measurement: MeasurementDevice,
+			Tags:        c.deviceTags(dev.Id),
+			Fields:      deviceFields(dev),
+			Time:        d.TimeStamp,
+		})
+	}
+	return points
+}
+
+// SensorData converts a live sensor reading into a device point.
+func (c *Converter) SensorData(d solarmanager.GetSensorDataResponse) Point {
+	return Point{
+		Measurement: MeasurementDevice,
+		Tags:        c.deviceTags(d.Data.Id),
+		Fields:      deviceFields(d.Data),
+		Time:        d.Date,
+	}
+}
+
+func (c *Converter) parseDate(s string) (time.Time, error) {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// SensorConsumption converts sensor consumption statistics into one
+// consumption point per bucket.
+func (c *Converter) SensorConsumption(s solarmanager.GetSensorConsumptionStatisticsResponse) ([]Point, error) {
+	points := make([]Point, 0, len(s.Data))
+	for _, d := range s.Data {
+		t, err := c.parseDate(d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags := c.deviceTags(s.SensorId)
+		tags[TagPeriod] = s.Period
+		points = append(points, Point{
+			Measurement: MeasurementConsumption,
+			Tags:        tags,
+			Fields:      map[string]interface{}{"consumption": float64(d.Consumption)},
+			Time:        t,
+		})
+	}
+	return points, nil
+}
+
+// GatewayConsumption converts gateway consumption statistics into one
+// consumption point per bucket.
+func (c *Converter) GatewayConsumption(s solarmanager.GetGatewayConsumptionStatisticsResponse) ([]Point, error) {
+	points := make([]Point, 0, len(s.Data))
+	for _, d := range s.Data {
+		t, err := c.parseDate(d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, Point{
+			Measurement: MeasurementConsumption,
+			Tags:        map[string]string{TagSmID: c.SmID, TagPeriod: s.Period},
+			Fields: map[string]interface{}{
+				"consumption": float64(d.Consumption),
+				"production":  float64(d.Production),
+			},
+			Time: t,
+		})
+	}
+	return points, nil
+}
+
+// Forecast converts PV production forecast entries into forecast points.
+func (c *Converter) Forecast(f solarmanager.GetGatewayForecastResponse) []Point {
+	points := make([]Point, 0, len(f))
+	for _, e := range f {
+		points = append(points, Point{
+			Measurement: MeasurementForecast,
+			Tags:        map[string]string{TagSmID: c.SmID},
+			Fields: map[string]interface{}{
+				"expected": float64(e.Expected),
+				"min":      float64(e.Min),
+				"max":      float64(e.Max),
+			},
+			Time: time.UnixMilli(e.Timestamp),
+		})
+	}
+	return points
+}
@@ -0,0 +1,163 @@
+package influx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+func TestPointString(t *testing.T) {
+	p := Point{
+		Measurement: "my measurement",
+		Tags:        map[string]string{"b": "x=y", "a": "1,2", "empty": ""},
+		Fields:      map[string]interface{}{"s": `say "hi"`, "i": 3, "f": 1.5, "ok": true},
+		Time:        time.Unix(1, 5),
+	}
+	expected := `my\ measurement,a=1\,2,b=x\=y f=1.5,i=3i,ok=true,s="say \"hi\"" 1000000005`
+	if got := p.String(); got != expected {
+		t.Fatalf("unexpected line, expected %q, but got %q", expected, got)
+	}
+}
+
+func TestGatewayData(t *testing.T) {
+	c := NewConverter("sm1", []solarmanager.SensorInfo{
+		{Id: "dev1", Type: "Water Heater", DeviceGroup: "myPV AC THOR"},
+	})
+	ts := time.Date(2021, 2, 1, 16, 9, 39, 0, time.UTC)
+	points := c.GatewayData(solarmanager.GetGatewayDataResponse{
+		TimeStamp:               ts,
+		CurrentPowerConsumption: 494,
+		Devices: []solarmanager.SensorData{
+			{Id: "dev1", CurrentPower: solarmanager.Some[solarmanager.Watt](1200), SOC: solarmanager.Null[int](), Signal: "connected", Extra: map[string]json.RawMessage{"inverterTemp": json.RawMessage("41.5")}},
+			{Id: "dev2"},
+		},
+	})
+	if len(points) != 3 {
+		t.Fatalf("unexpected number of points, expected 3, but got %d", len(points))
+	}
+	if points[0].Measurement != MeasurementGateway || points[0].Fields["current_power_consumption"] != 494.0 {
+		t.Fatalf("unexpected gateway point %s", points[0])
+	}
+	expected := `solarmanager_device,device_group=myPV\ AC\ THOR,sensor_id=dev1,sm_id=sm1,type=Water\ Heater `
+	if got := points[1].String(); !strings.HasPrefix(got, expected) || !strings.Contains(got, "current_power=1200,") || !strings.Contains(got, "inverterTemp=41.5") {
+		t.Fatalf("unexpected device point %q", got)
+	}
+	if _, ok := points[1].Fields["soc"]; ok {
+		t.Fatalf("unexpected soc field for null value")
+	}
+	if _, ok := points[2].Tags[TagType]; ok {
+		t.Fatalf("unexpected type tag for unknown sensor")
+	}
+}
+
+func TestConsumption(t *testing.T) {
+	c := NewConverter("sm1", nil)
+	c.Location = time.FixedZone("CET", 3600)
+	var s solarmanager.GetSensorConsumptionStatisticsResponse
+	s.SensorId = "dev1"
+	s.Period = "day"
+	s.Data = append(s.Data, solarmanager.SensorConsumption{CreatedAt: "2021-01-01", Consumption: 120.5})
+	points, err := c.SensorConsumption(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `solarmanager_consumption,period=day,sensor_id=dev1,sm_id=sm1 consumption=120.5 1609455600000000000`
+	if got := points[0].String(); got != expected {
+		t.Fatalf("unexpected line, expected %q, but got %q", expected, got)
+	}
+}
+
+func TestForecast(t *testing.T) {
+	c := NewConverter("sm1", nil)
+	points := c.Forecast(solarmanager.GetGatewayForecastResponse{{Timestamp: 1641808800000, Expected: 1726, Min: 1183, Max: 2269}})
+	expected := `solarmanager_forecast,sm_id=sm1 expected=1726,max=2269,min=1183 1641808800000000000`
+	if got := points[0].String(); got != expected {
+		t.Fatalf("unexpected line, expected %q, but got %q", expected, got)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+
+	w := NewWriter(nil, svr.URL+"/api/v2/write?bucket=b")
+	w.BatchSize = 2
+	w.Header.Set("Authorization", "Token secret")
+	p := Point{Measurement: "m", Fields: map[string]interface{}{"v": 1}}
+	if err := w.Write(p, p, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("unexpected number of requests, expected 2, but got %d", len(bodies))
+	}
+	if bodies[0] != "m v=1i\nm v=1i\n" || bodies[1] != "m v=1i\n" {
+		t.Fatalf("unexpected bodies %q", bodies)
+	}
+
+	w.Header.Del("Authorization")
+	if err := w.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err == nil {
+		t.Fatal("expected error for unauthorized write")
+	}
+	w.Header.Set("Authorization", "Token secret")
+	if err := w.Flush(); err != nil || len(bodies) != 3 || bodies[2] != "m v=1i\n" {
+		t.Fatalf("points of failed write not kept: %q, %v", bodies, err)
+	}
+}
+
+func TestFlushContext(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer svr.Close()
+	defer close(release)
+
+	w := NewWriter(nil, svr.URL)
+	p := Point{Measurement: "m", Fields: map[string]interface{}{"v": 1}}
+	w.Write(p)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.FlushContext(ctx) }()
+	<-received
+
+	// Writes must not wait for the slow request.
+	if err := w.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if len(w.buf) != 2 {
+		t.Fatalf("expected the points to be kept, got %d", len(w.buf))
+	}
+}
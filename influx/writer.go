@@ -0,0 +1,133 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const defaultBatchSize = 5000
+
+// Writer batches points and posts them in line protocol to an HTTP endpoint,
+// e.g. http://localhost:8086/api/v2/write?org=o&bucket=b&precision=ns for
+// InfluxDB 2 or http://localhost:8428/write for VictoriaMetrics.
+// It is safe for concurrent use.
+type Writer struct {
+	// URL is the write endpoint, including any query parameters.
+	URL string
+	// Header is added to every write request, e.g. for an Authorization token.
+	Header http.Header
+	// BatchSize is the number of points after which Write flushes
+	// automatically. If zero, a default of 5000 is used.
+	BatchSize int
+
+	client *http.Client
+	mu     sync.Mutex
+	buf    []Point
+}
+
+// NewWriter returns a new Writer posting to the given endpoint.
+// If a nil httpClient is provided, a new http.Client will be used.
+func NewWriter(httpClient *http.Client, endpoint string) *Writer {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return &Writer{
+		URL:    endpoint,
+		Header: make(http.Header),
+		client: httpClient,
+	}
+}
+
+// Write adds points to the current batch and flushes it once BatchSize points
+// have been buffered.
+func (w *Writer) Write(points ...Point) error {
+	batchSize := w.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	w.mu.Lock()
+	w.buf = append(w.buf, points...)
+	var batches [][]Point
+	for len(w.buf) >= batchSize {
+		batches = append(batches, w.buf[:batchSize:batchSize])
+		w.buf = w.buf[batchSize:]
+	}
+	w.mu.Unlock()
+
+	for i, batch := range batches {
+		if err := w.post(context.Background(), batch); err != nil {
+			w.requeue(batches[i:]...)
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush posts all buffered points.
+func (w *Writer) Flush() error {
+	return w.FlushContext(context.Background())
+}
+
+// FlushContext is like Flush with a context. Writes are not blocked while
+// the points are posted. If posting fails, the points are kept for the next
+// flush.
+func (w *Writer) FlushContext(ctx context.Context) error {
+	w.mu.Lock()
+	batch := w.buf
+	w.buf = nil
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := w.post(ctx, batch); err != nil {
+		w.requeue(batch)
+		return err
+	}
+	return nil
+}
+
+// requeue puts batches that couldn't be posted back in front of the buffer.
+func (w *Writer) requeue(batches ...[]Point) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var buf []Point
+	for _, b := range batches {
+		buf = append(buf, b...)
+	}
+	w.buf = append(buf, w.buf...)
+}
+
+func (w *Writer) post(ctx context.Context, points []Point) error {
+	var b strings.Builder
+	for _, p := range points {
+		p.writeTo(&b)
+		b.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewBufferString(b.String()))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("influx: write failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package inventory
+
+import "github.com/ingmarstein/solarmanager-go/solarmanager"
+
+// SensorIndex is an immutable view of the sensors of a gateway, indexed by
+// id, type, device group and tag name.
+type SensorIndex struct {
+	sensors       []solarmanager.SensorInfo
+	byID          map[string]int
+	byType        map[string][]int
+	byDeviceGroup map[string][]int
+	byTag         map[string][]int
+}
+
+// NewSensorIndex returns an index of the given sensors. If several sensors
+// share an id, the last one wins.
+func NewSensorIndex(sensors []solarmanager.SensorInfo) *SensorIndex {
+	x := &SensorIndex{
+		sensors:       append([]solarmanager.SensorInfo(nil), sensors...),
+		byID:          make(map[string]int, len(sensors)),
+		byType:        make(map[string][]int),
+		byDeviceGroup: make(map[string][]int),
+		byTag:         make(map[string][]int),
+	}
+	for i, s := range x.sensors {
+		x.byID[s.Id] = i
+		x.byType[s.Type] = append(x.byType[s.Type], i)
+		x.byDeviceGroup[s.DeviceGroup] = append(x.byDeviceGroup[s.DeviceGroup], i)
+		if s.Tag.Name != "" {
+			x.byTag[s.Tag.Name] = append(x.byTag[s.Tag.Name], i)
+		}
+	}
+	return x
+}
+
+// Len returns the number of sensors.
+func (x *SensorIndex) Len() int {
+	return len(x.sensors)
+}
+
+// Sensors returns all sensors in the order reported by the API.
+func (x *SensorIndex) Sensors() []solarmanager.SensorInfo {
+	return append([]solarmanager.SensorInfo(nil), x.sensors...)
+}
+
+// Get returns the sensor with the given _id.
+func (x *SensorIndex) Get(id string) (solarmanager.SensorInfo, bool) {
+	i, ok := x.byID[id]
+	if !ok {
+		return solarmanager.SensorInfo{}, false
+	}
+	return x.sensors[i], true
+}
+
+// ByType returns the sensors of the given type, e.g. "Water Heater".
+func (x *SensorIndex) ByType(typ string) []solarmanager.SensorInfo {
+	return x.lookup(x.byType[typ])
+}
+
+// ByDeviceGroup returns the sensors of the given device group, e.g.
+// "myPV AC THOR".
+func (x *SensorIndex) ByDeviceGroup(group string) []solarmanager.SensorInfo {
+	return x.lookup(x.byDeviceGroup[group])
+}
+
+// ByTag returns the sensors tagged with the given tag name.
+func (x *SensorIndex) ByTag(name string) []solarmanager.SensorInfo {
+	return x.lookup(x.byTag[name])
+}
+
+func (x *SensorIndex) lookup(indices []int) []solarmanager.SensorInfo {
+	if len(indices) == 0 {
+		return nil
+	}
+	sensors := make([]solarmanager.SensorInfo, len(indices))
+	for i, j := range indices {
+		sensors[i] = x.sensors[j]
+	}
+	return sensors
+}
@@ -0,0 +1,208 @@
+// Package inventory caches the sensor metadata of SolarManager gateways,
+// which rarely changes but is needed to label the live data of every poll.
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// DefaultTTL is the TTL used by New if none is given.
+const DefaultTTL = 15 * time.Minute
+
+// Source provides the sensor metadata. It is implemented by
+// *solarmanager.Client.
+type Source interface {
+	GetSensors(solarManagerID string) (solarmanager.GetSensorsResponse, error)
+	GetSensor(sensorID string) (solarmanager.GetSensorResponse, error)
+}
+
+// Cache wraps the info endpoints of a Source and keeps their responses for
+// TTL. Concurrent requests for the same missing entry are collapsed into a
+// single fetch. Errors are not cached. Cache implements Source itself, so it
+// can be used in place of the client. It is safe for concurrent use.
+type Cache struct {
+	// TTL is the time after which entries are fetched again.
+	TTL time.Duration
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+	// ErrorHandler, if set, is called with errors of background refreshes.
+	ErrorHandler func(solarManagerID string, err error)
+
+	src Source
+
+	mu       sync.Mutex
+	gen      uint64 // incremented by invalidations
+	gateways map[string]entry
+	sensors  map[string]entry
+	calls    map[string]*call
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// call is an in-flight fetch that concurrent callers wait for.
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// New returns a Cache for src. If ttl is 0, DefaultTTL is used.
+func New(src Source, ttl time.Duration) *Cache {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	return &Cache{
+		TTL:      ttl,
+		Now:      time.Now,
+		src:      src,
+		gateways: make(map[string]entry),
+		sensors:  make(map[string]entry),
+		calls:    make(map[string]*call),
+	}
+}
+
+var _ Source = (*Cache)(nil)
+
+// Index returns the sensor index of the given gateway, fetching the sensors
+// if they are not cached or expired.
+func (c *Cache) Index(solarManagerID string) (*SensorIndex, error) {
+	v, err := c.get(c.gateways, "gateway/"+solarManagerID, solarManagerID, false, c.fetchIndex)
+	if err != nil {
+		return nil, err
+	}
+	return v.(*SensorIndex), nil
+}
+
+// GetSensors returns the sensors of the given gateway like
+// solarmanager.Client.GetSensors, but from the cache.
+func (c *Cache) GetSensors(solarManagerID string) (solarmanager.GetSensorsResponse, error) {
+	x, err := c.Index(solarManagerID)
+	if err != nil {
+		return nil, err
+	}
+	return x.Sensors(), nil
+}
+
+// GetSensor returns a single sensor like solarmanager.Client.GetSensor, but
+// from the cache.
+func (c *Cache) GetSensor(sensorID string) (solarmanager.GetSensorResponse, error) {
+	v, err := c.get(c.sensors, "sensor/"+sensorID, sensorID, false, c.fetchSensor)
+	if err != nil {
+		return solarmanager.GetSensorResponse{}, err
+	}
+	return v.(solarmanager.GetSensorResponse), nil
+}
+
+// Refresh fetches the sensors of the given gateway regardless of the TTL.
+func (c *Cache) Refresh(solarManagerID string) (*SensorIndex, error) {
+	v, err := c.get(c.gateways, "gateway/"+solarManagerID, solarManagerID, true, c.fetchIndex)
+	if err != nil {
+		return nil, err
+	}
+	return v.(*SensorIndex), nil
+}
+
+// RefreshEvery refreshes the sensors of the given gateways every interval
+// until ctx is done, so that Index never blocks on the API. Errors are passed
+// to ErrorHandler and leave the cached sensors in place.
+func (c *Cache) RefreshEvery(ctx context.Context, interval time.Duration, solarManagerIDs ...string) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, id := range solarManagerIDs {
+			if _, err := c.Refresh(id); err != nil && c.ErrorHandler != nil {
+				c.ErrorHandler(id, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Invalidate drops the cached sensors of the given gateway.
+func (c *Cache) Invalidate(solarManagerID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	delete(c.gateways, solarManagerID)
+}
+
+// InvalidateSensor drops the cached GetSensor response of the given sensor.
+func (c *Cache) InvalidateSensor(sensorID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	delete(c.sensors, sensorID)
+}
+
+// InvalidateAll empties the cache.
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	clear(c.gateways)
+	clear(c.sensors)
+}
+
+func (c *Cache) fetchIndex(solarManagerID string) (interface{}, error) {
+	sensors, err := c.src.GetSensors(solarManagerID)
+	if err != nil {
+		return nil, err
+	}
+	return NewSensorIndex(sensors), nil
+}
+
+func (c *Cache) fetchSensor(sensorID string) (interface{}, error) {
+	return c.src.GetSensor(sensorID)
+}
+
+// get returns the entry id of m, calling fetch if it is missing, expired or
+// force is set. Concurrent fetches of the same key share a single call. A
+// panic in fetch is returned as an error to all of them.
+func (c *Cache) get(m map[string]entry, key, id string, force bool, fetch func(id string) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	if e, ok := m[id]; ok && !force && c.Now().Before(e.expires) {
+		c.mu.Unlock()
+		return e.value, nil
+	}
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-cl.done
+		return cl.value, cl.err
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	gen := c.gen
+	c.mu.Unlock()
+
+	func() {
+		// A panicking fetch must not leave the waiters blocked on cl.done.
+		defer func() {
+			if r := recover(); r != nil {
+				cl.value, cl.err = nil, fmt.Errorf("inventory: fetching %s panicked: %v", key, r)
+			}
+		}()
+		cl.value, cl.err = fetch(id)
+	}()
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	// Results of fetches that raced with an invalidation may be stale.
+	if cl.err == nil && gen == c.gen {
+		m[id] = entry{value: cl.value, expires: c.Now().Add(c.TTL)}
+	}
+	c.mu.Unlock()
+	close(cl.done)
+	return cl.value, cl.err
+}
@@ -0,0 +1,216 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+	"github.com/ingmarstein/solarmanager-go/solarmanagertest"
+)
+
+func testSensors() solarmanager.GetSensorsResponse {
+	sensors := solarmanager.GetSensorsResponse{
+		{Id: "heater", Type: "Water Heater", DeviceGroup: "myPV AC THOR"},
+		{Id: "car", Type: "Car Charging", DeviceGroup: "Easee"},
+		{Id: "meter", Type: "Smart Meter", DeviceGroup: "Easee"},
+	}
+	sensors[0].Tag.Name = "Tag_1"
+	sensors[1].Tag.Name = "Tag_1"
+	return sensors
+}
+
+func TestSensorIndex(t *testing.T) {
+	x := NewSensorIndex(testSensors())
+	if x.Len() != 3 {
+		t.Fatalf("unexpected length %d", x.Len())
+	}
+	if s, ok := x.Get("car"); !ok || s.Type != "Car Charging" {
+		t.Fatalf("unexpected sensor %+v", s)
+	}
+	if _, ok := x.Get("missing"); ok {
+		t.Fatal("unexpected sensor for missing id")
+	}
+	if s := x.ByType("Water Heater"); len(s) != 1 || s[0].Id != "heater" {
+		t.Fatalf("unexpected sensors by type %+v", s)
+	}
+	if s := x.ByDeviceGroup("Easee"); len(s) != 2 || s[0].Id != "car" || s[1].Id != "meter" {
+		t.Fatalf("unexpected sensors by device group %+v", s)
+	}
+	if s := x.ByTag("Tag_1"); len(s) != 2 {
+		t.Fatalf("unexpected sensors by tag %+v", s)
+	}
+	if s := x.ByTag(""); s != nil {
+		t.Fatalf("unexpected untagged sensors %+v", s)
+	}
+}
+
+func TestCache(t *testing.T) {
+	fake := &solarmanagertest.Fake{
+		GetSensorsFunc: func(string) (solarmanager.GetSensorsResponse, error) {
+			return testSensors(), nil
+		},
+		GetSensorFunc: func(id string) (solarmanager.GetSensorResponse, error) {
+			return solarmanager.GetSensorResponse{Id: id}, nil
+		},
+	}
+	now := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	c := New(fake, time.Minute)
+	c.Now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if x, err := c.Index("sm1"); err != nil || x.Len() != 3 {
+			t.Fatalf("unexpected index %v (%v)", x, err)
+		}
+		if s, err := c.GetSensor("car"); err != nil || s.Id != "car" {
+			t.Fatalf("unexpected sensor %+v (%v)", s, err)
+		}
+	}
+	if n := len(fake.CallsTo("GetSensors")); n != 1 {
+		t.Fatalf("expected 1 GetSensors call, got %d", n)
+	}
+	if n := len(fake.CallsTo("GetSensor")); n != 1 {
+		t.Fatalf("expected 1 GetSensor call, got %d", n)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := c.GetSensors("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	c.Invalidate("sm1")
+	if _, err := c.GetSensors("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Refresh("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.CallsTo("GetSensors")); n != 4 {
+		t.Fatalf("expected 4 GetSensors calls after expiry, invalidation and refresh, got %d", n)
+	}
+
+	c.InvalidateAll()
+	fake.GetSensorsFunc = func(string) (solarmanager.GetSensorsResponse, error) {
+		return nil, errors.New("boom")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Index("sm1"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if n := len(fake.CallsTo("GetSensors")); n != 6 {
+		t.Fatalf("errors must not be cached, got %d calls", n)
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	release := make(chan struct{})
+	fake := &solarmanagertest.Fake{
+		GetSensorsFunc: func(string) (solarmanager.GetSensorsResponse, error) {
+			<-release
+			return testSensors(), nil
+		},
+	}
+	c := New(fake, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x, err := c.Index("sm1"); err != nil || x.Len() != 3 {
+				t.Errorf("unexpected index %v (%v)", x, err)
+			}
+		}()
+	}
+	// Give the goroutines a chance to pile up behind the first fetch.
+	for len(fake.CallsTo("GetSensors")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := len(fake.CallsTo("GetSensors")); n != 1 {
+		t.Fatalf("expected concurrent fetches to be collapsed, got %d calls", n)
+	}
+}
+
+func TestCachePanic(t *testing.T) {
+	release := make(chan struct{})
+	fake := &solarmanagertest.Fake{
+		GetSensorsFunc: func(string) (solarmanager.GetSensorsResponse, error) {
+			<-release
+			panic("boom")
+		},
+	}
+	c := New(fake, 0)
+
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := c.Index("sm1")
+			errs <- err
+		}()
+	}
+	for len(fake.CallsTo("GetSensors")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), "panicked: boom") {
+			t.Fatalf("expected panic error, got %v", err)
+		}
+	}
+
+	fake.GetSensorsFunc = func(string) (solarmanager.GetSensorsResponse, error) {
+		return testSensors(), nil
+	}
+	if x, err := c.Index("sm1"); err != nil || x.Len() != 3 {
+		t.Fatalf("unexpected index after panic %v (%v)", x, err)
+	}
+}
+
+func TestRefreshEvery(t *testing.T) {
+	fail := errors.New("boom")
+	var mu sync.Mutex
+	calls := 0
+	fake := &solarmanagertest.Fake{
+		GetSensorsFunc: func(string) (solarmanager.GetSensorsResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			if calls > 1 {
+				return nil, fail
+			}
+			return testSensors(), nil
+		},
+	}
+	c := New(fake, time.Hour)
+	errs := make(chan error, 10)
+	c.ErrorHandler = func(smID string, err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.RefreshEvery(ctx, time.Millisecond, "sm1")
+		close(done)
+	}()
+	if err := <-errs; err != fail {
+		t.Fatalf("unexpected error %v", err)
+	}
+	cancel()
+	<-done
+
+	// The sensors of the first refresh remain cached.
+	if x, err := c.Index("sm1"); err != nil || x.Len() != 3 {
+		t.Fatalf("unexpected index %v (%v)", x, err)
+	}
+}
@@ -0,0 +1,241 @@
+package solarmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to API requests.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// Refresher is implemented by Authenticators whose credentials can be
+// renewed. After a 401 response, Client calls Refresh with the rejected
+// request and retries it once with fresh credentials.
+type Refresher interface {
+	Refresh(ctx context.Context, rejected *http.Request) error
+}
+
+// BasicAuth authenticates requests with HTTP Basic authentication. This is
+// what Client does by default, using its Username and Password fields.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// Token is an access token obtained by TokenAuth.
+type Token struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	// Expiry is zero if the server didn't report one. Such a token is used
+	// until it is rejected.
+	Expiry time.Time `json:"expiry"`
+}
+
+// TokenStore persists tokens, so that TokenAuth doesn't need to log in again
+// after a restart.
+type TokenStore interface {
+	// Load returns the stored token, or nil if there is none.
+	Load() (*Token, error)
+	Save(t *Token) error
+}
+
+// FileTokenStore stores the token as JSON in the file at Path, which is only
+// readable by the current user.
+type FileTokenStore struct {
+	Path string
+}
+
+func (s FileTokenStore) Load() (*Token, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var t Token
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s FileTokenStore) Save(t *Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so a crash doesn't leave a partial
+	// token behind.
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.Path)
+}
+
+// tokenExpiryDelta is how long before its expiry a token is refreshed.
+const tokenExpiryDelta = 30 * time.Second
+
+// TokenAuth authenticates requests with a bearer token obtained from the
+// v1/oauth/login endpoint. The token is renewed with its refresh token
+// shortly before it expires or when it is rejected, falling back to a new
+// login if that fails. TokenAuth is safe for concurrent use.
+type TokenAuth struct {
+	Email    string
+	Password string
+	// Store, if set, is used to persist the token across restarts.
+	Store TokenStore
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+
+	client *Client
+
+	mu     sync.Mutex
+	token  *Token
+	loaded bool // the token has been loaded from Store
+}
+
+// NewTokenAuth returns a TokenAuth logging in through the base URL and HTTP
+// client of c. It is typically assigned to c.Authenticator.
+func NewTokenAuth(c *Client, email, password string) *TokenAuth {
+	return &TokenAuth{Email: email, Password: password, Now: time.Now, client: c}
+}
+
+func (a *TokenAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	t, err := a.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.AccessToken)
+	return nil
+}
+
+// Token returns a valid token, logging in or refreshing it as necessary.
+func (a *TokenAuth) Token(ctx context.Context) (*Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.loaded && a.Store != nil {
+		t, err := a.Store.Load()
+		if err != nil {
+			return nil, err
+		}
+		a.token, a.loaded = t, true
+	}
+	if a.token != nil && (a.token.Expiry.IsZero() || a.now().Add(tokenExpiryDelta).Before(a.token.Expiry)) {
+		return a.token, nil
+	}
+	return a.renew(ctx)
+}
+
+func (a *TokenAuth) now() time.Time {
+	if a.Now == nil {
+		return time.Now()
+	}
+	return a.Now()
+}
+
+// Refresh renews the token if it is the one used by the rejected request.
+// Otherwise, another request has already renewed it.
+func (a *TokenAuth) Refresh(ctx context.Context, rejected *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != nil && rejected.Header.Get("Authorization") != "Bearer "+a.token.AccessToken {
+		return nil
+	}
+	_, err := a.renew(ctx)
+	return err
+}
+
+// renew refreshes the token, or logs in again if there is no refresh token
+// or it is rejected. a.mu must be held.
+func (a *TokenAuth) renew(ctx context.Context) (*Token, error) {
+	var t *Token
+	var err error
+	if a.token != nil && a.token.RefreshToken != "" {
+		t, err = a.post(ctx, "v1/oauth/refresh", map[string]string{"refreshToken": a.token.RefreshToken})
+	}
+	if t == nil {
+		t, err = a.post(ctx, "v1/oauth/login", map[string]string{"email": a.Email, "password": a.Password})
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.token = t
+	if a.Store != nil {
+		if err := a.Store.Save(t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (a *TokenAuth) post(ctx context.Context, urlStr string, body interface{}) (*Token, error) {
+	if a.client == nil {
+		return nil, errors.New("solarmanager: TokenAuth without client, use NewTokenAuth")
+	}
+	u, err := a.client.BaseURL.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if a.client.UserAgent != "" {
+		req.Header.Set("User-Agent", a.client.UserAgent)
+	}
+
+	resp, err := a.client.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	var response struct {
+		AccessToken  string `json:"accessToken"`
+		RefreshToken string `json:"refreshToken"`
+		ExpiresIn    int    `json:"expiresIn"` // seconds, 0 if unknown
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.AccessToken == "" {
+		return nil, errors.New("solarmanager: no access token in response")
+	}
+	t := &Token{AccessToken: response.AccessToken, RefreshToken: response.RefreshToken}
+	if response.ExpiresIn > 0 {
+		t.Expiry = a.now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
@@ -0,0 +1,83 @@
+package solarmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultConcurrency is the number of concurrent requests made by
+// GetAllSensorData if no limit is given.
+const DefaultConcurrency = 4
+
+// SensorError reports a failed request for a single sensor.
+type SensorError struct {
+	SensorID string
+	Err      error
+}
+
+func (e *SensorError) Error() string {
+	return fmt.Sprintf("sensor %s: %v", e.SensorID, e.Err)
+}
+
+func (e *SensorError) Unwrap() error {
+	return e.Err
+}
+
+// GetAllSensorData fetches the sensors of the gateway and then the live data
+// of each of them, making at most concurrency requests at a time. If
+// concurrency is 0, DefaultConcurrency is used. Requests wait for the
+// client's Limiter, if any.
+//
+// The results are keyed by sensor id. If some requests fail, the other
+// results are returned together with an error joining a *SensorError per
+// failed sensor. If ctx is done, no further requests are started and its
+// error is included.
+func (c *Client) GetAllSensorData(ctx context.Context, solarManagerID string, concurrency int) (map[string]GetSensorDataResponse, error) {
+	sensors, err := c.GetSensorsContext(ctx, solarManagerID)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]GetSensorDataResponse, len(sensors))
+		// errs is indexed like sensors, so the error order is stable.
+		errs = make([]error, len(sensors), len(sensors)+1)
+	)
+	sem := make(chan struct{}, concurrency)
+loop:
+	for i, s := range sensors {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		wg.Add(1)
+		go func(i int, sensorID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d, err := c.GetSensorDataContext(ctx, solarManagerID, sensorID)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[i] = &SensorError{SensorID: sensorID, Err: err}
+				return
+			}
+			results[sensorID] = d
+		}(i, s.Id)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return results, errors.Join(errs...)
+}
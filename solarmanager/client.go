@@ -4,12 +4,15 @@ package solarmanager
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
+	"reflect"
 )
 
 const (
@@ -24,26 +27,55 @@ type Client struct {
 	Username  string
 	Password  string
 
-	client *http.Client
+	// SchemaWarningHandler enables strict decoding if set. It is called for
+	// every response field that is unknown or doesn't match the Go type, so
+	// API changes can be detected. In strict mode, type mismatches are not
+	// returned as errors: the mismatched fields are left unchanged and the
+	// rest of the response is decoded.
+	SchemaWarningHandler func(w SchemaWarning)
+
+	// RawResponseHandler, if set, is called with the raw JSON body of every
+	// successful response before it is decoded. See WithRawResponse for
+	// the body of a single call.
+	RawResponseHandler func(req *http.Request, body []byte)
+
+	// Limiter, if set, is waited on before every request.
+	Limiter Limiter
+
+	// Authenticator, if set, authenticates requests instead of Basic
+	// authentication with Username and Password.
+	Authenticator Authenticator
+
+	// Retry configures the retry of failed requests. By default, requests
+	// are not retried.
+	Retry RetryPolicy
+
+	// Logger receives the output of Verbose mode. If nil, the standard
+	// logger is used.
+	Logger *log.Logger
+
+	client     *http.Client
+	telemetry  *telemetry
+	middleware []Middleware
+}
+
+// Limiter limits the rate of API requests. It is implemented by
+// *rate.Limiter from golang.org/x/time/rate.
+type Limiter interface {
+	// Wait blocks until a request may be made or ctx is done.
+	Wait(ctx context.Context) error
 }
 
 // NewClient returns a new SolarManager API client using the supplied credentials.
-// If a nil httpClient is provided, a new http.Client will be used.
+// If a nil httpClient is provided, a new http.Client will be used. See
+// NewClientWithOptions for further settings.
 func NewClient(httpClient *http.Client, baseURL *url.URL, username, password string) *Client {
-	if httpClient == nil {
-		httpClient = &http.Client{}
-	}
-	if baseURL == nil {
-		baseURL, _ = url.Parse(defaultBaseURL)
-	}
-
-	return &Client{
-		client:    httpClient,
-		BaseURL:   baseURL,
-		UserAgent: userAgent,
-		Username:  username,
-		Password:  password,
-	}
+	return newClient(&options{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		username:   username,
+		password:   password,
+	})
 }
 
 // NewRequest creates an API request. A relative URL can be provided in urlStr,
@@ -73,7 +105,9 @@ func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Requ
 		return nil, err
 	}
 
-	req.SetBasicAuth(c.Username, c.Password)
+	if c.Authenticator == nil {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
 
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
@@ -85,27 +119,135 @@ func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Requ
 	return req, nil
 }
 
-func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
-	if c.Verbose {
-		if d, err := httputil.DumpRequest(req, true); err == nil {
-			log.Println(string(d))
-		}
+// ErrorResponse reports an error caused by an API request.
+type ErrorResponse struct {
+	Response *http.Response // HTTP response that caused this error
+	Message  string         `json:"message"` // error message returned by the API, if any
+}
+
+func (r *ErrorResponse) Error() string {
+	msg := r.Message
+	if msg == "" {
+		msg = http.StatusText(r.Response.StatusCode)
+	}
+	return fmt.Sprintf("%v %v: %d %v",
+		r.Response.Request.Method, r.Response.Request.URL, r.Response.StatusCode, msg)
+}
+
+// CheckResponse checks the API response for errors and returns them if
+// present. A response is considered an error if it has a status code outside
+// the 200 range. The API error message is read from the response body if
+// available.
+func CheckResponse(r *http.Response) error {
+	if c := r.StatusCode; 200 <= c && c <= 299 {
+		return nil
+	}
+	errorResponse := &ErrorResponse{Response: r}
+	data, err := io.ReadAll(r.Body)
+	if err == nil && data != nil {
+		json.Unmarshal(data, errorResponse)
 	}
+	return errorResponse
+}
 
-	resp, err := c.client.Do(req)
+type rawResponseKey struct{}
 
-	if c.Verbose {
-		if d, err := httputil.DumpResponse(resp, true); err == nil {
-			log.Println(string(d))
+// WithRawResponse returns a copy of ctx that makes the calls it is passed to
+// store the raw JSON body of their successful response in *raw:
+//
+//	var raw []byte
+//	data, err := c.GetGatewayDataContext(solarmanager.WithRawResponse(ctx, &raw), smID)
+func WithRawResponse(ctx context.Context, raw *[]byte) context.Context {
+	return context.WithValue(ctx, rawResponseKey{}, raw)
+}
+
+// send authenticates and sends req.
+func (c *Client) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.Authenticator != nil {
+		if err := c.Authenticator.Authenticate(ctx, req); err != nil {
+			return nil, err
 		}
 	}
+	return c.client.Do(req)
+}
 
+func (c *Client) do(ctx context.Context, op Operation, req *http.Request, v interface{}) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	resp, err := c.handler()(ctx, op, req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
-		return nil, err
+		return resp, err
+	}
+	// Responses returned by middleware haven't been checked yet.
+	if err := CheckResponse(resp); err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if raw, ok := ctx.Value(rawResponseKey{}).(*[]byte); ok {
+		*raw = body
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusNoContent {
-		err = json.NewDecoder(resp.Body).Decode(v)
+	if c.RawResponseHandler != nil {
+		c.RawResponseHandler(req, body)
 	}
+	err = json.Unmarshal(body, v)
+	var mismatch *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &mismatch) {
+		return resp, err
+	}
+	// encoding/json decodes the rest of the document after a type mismatch,
+	// and the response types skip mismatched values in nested objects
+	// instead of failing, so v is complete here. Mismatches are found by
+	// comparing the body with the Go type, and are either reported as
+	// warnings in strict mode or returned as an error.
+	if c.SchemaWarningHandler != nil {
+		err = nil
+	}
+	checkSchema(body, reflect.TypeOf(v), func(kind SchemaWarningKind, path string, value json.RawMessage, goType reflect.Type) {
+		switch {
+		case c.SchemaWarningHandler != nil:
+			w := SchemaWarning{Method: req.Method, URL: req.URL.String(), Kind: kind, Path: path, Value: value}
+			if goType != nil {
+				w.GoType = goType.String()
+			}
+			c.SchemaWarningHandler(w)
+		case kind == TypeMismatch && err == nil:
+			err = typeError(reflect.TypeOf(v), path, value, goType)
+		}
+	})
 	return resp, err
 }
+
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
+// replayable reports whether req can be sent again.
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// replay returns a copy of req with a fresh body.
+func replay(ctx context.Context, req *http.Request) (*http.Request, error) {
+	r := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
@@ -0,0 +1,403 @@
+package solarmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// decodeWithExtra decodes data into v, a pointer to a struct type without
+// custom JSON methods, and returns the object members without a matching
+// struct field.
+//
+// Values that don't match the Go type of their field are skipped rather than
+// returned as an error: encoding/json aborts decoding the enclosing value on
+// the first error an UnmarshalJSON method returns, so a single mismatch in a
+// nested object would drop everything that follows it. Client.do finds such
+// mismatches by comparing the response with the Go type instead.
+func decodeWithExtra(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	err := json.Unmarshal(data, v)
+	var mismatch *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &mismatch) {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		return nil, nil
+	}
+	fields := jsonFields(reflect.TypeOf(v).Elem())
+	for key := range obj {
+		if _, ok := fields[key]; ok {
+			delete(obj, key)
+			continue
+		}
+		for name := range fields {
+			if strings.EqualFold(name, key) {
+				delete(obj, key)
+				break
+			}
+		}
+	}
+	if len(obj) == 0 {
+		obj = nil
+	}
+	return obj, nil
+}
+
+// marshalWithExtra encodes v, a struct type without custom JSON methods, and
+// appends the members of extra that don't collide with its fields. Absent
+// Optional fields are omitted, also in nested anonymous structs.
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := marshalObject(&buf, reflect.ValueOf(v), extra); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func marshalObject(buf *bytes.Buffer, v reflect.Value, extra map[string]json.RawMessage) error {
+	t := v.Type()
+	known := make(map[string]bool)
+	buf.WriteByte('{')
+	first := true
+	member := func(name string, write func() error) error {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		return write()
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		known[name] = true
+		fv := v.Field(i)
+		if o, ok := fv.Interface().(optional); ok && o.IsZero() {
+			continue
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+			continue
+		}
+		err := member(name, func() error {
+			if f.Type.Kind() == reflect.Struct && f.Type.Name() == "" && !f.Type.Implements(marshalerType) {
+				return marshalObject(buf, fv, nil)
+			}
+			data, err := json.Marshal(fv.Interface())
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		if !known[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := member(k, func() error { return json.Compact(buf, extra[k]) }); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// isEmptyValue reports whether v is empty as defined by the omitempty option
+// of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (g *GatewayInfo) UnmarshalJSON(data []byte) error {
+	type gatewayInfo GatewayInfo
+	var err error
+	g.Extra, err = decodeWithExtra(data, (*gatewayInfo)(g))
+	return err
+}
+
+func (g GatewayInfo) MarshalJSON() ([]byte, error) {
+	type gatewayInfo GatewayInfo
+	return marshalWithExtra(gatewayInfo(g), g.Extra)
+}
+
+func (s *SensorInfo) UnmarshalJSON(data []byte) error {
+	type sensorInfo SensorInfo
+	var err error
+	s.Extra, err = decodeWithExtra(data, (*sensorInfo)(s))
+	return err
+}
+
+func (s SensorInfo) MarshalJSON() ([]byte, error) {
+	type sensorInfo SensorInfo
+	return marshalWithExtra(sensorInfo(s), s.Extra)
+}
+
+func (u *User) UnmarshalJSON(data []byte) error {
+	type user User
+	var err error
+	u.Extra, err = decodeWithExtra(data, (*user)(u))
+	return err
+}
+
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User
+	return marshalWithExtra(user(u), u.Extra)
+}
+
+func (s *SensorData) UnmarshalJSON(data []byte) error {
+	type sensorData SensorData
+	var err error
+	s.Extra, err = decodeWithExtra(data, (*sensorData)(s))
+	return err
+}
+
+func (s SensorData) MarshalJSON() ([]byte, error) {
+	type sensorData SensorData
+	return marshalWithExtra(sensorData(s), s.Extra)
+}
+
+func (g *GatewayData) UnmarshalJSON(data []byte) error {
+	type gatewayData GatewayData
+	var err error
+	g.Extra, err = decodeWithExtra(data, (*gatewayData)(g))
+	return err
+}
+
+func (g GatewayData) MarshalJSON() ([]byte, error) {
+	type gatewayData GatewayData
+	return marshalWithExtra(gatewayData(g), g.Extra)
+}
+
+func (r *GetGatewayInfoResponse) UnmarshalJSON(data []byte) error {
+	type getGatewayInfoResponse GetGatewayInfoResponse
+	var err error
+	r.Extra, err = decodeWithExtra(data, (*getGatewayInfoResponse)(r))
+	return err
+}
+
+func (r GetGatewayInfoResponse) MarshalJSON() ([]byte, error) {
+	type getGatewayInfoResponse GetGatewayInfoResponse
+	return marshalWithExtra(getGatewayInfoResponse(r), r.Extra)
+}
+
+func (r *GetSensorResponse) UnmarshalJSON(data []byte) error {
+	return (*SensorInfo)(r).UnmarshalJSON(data)
+}
+
+func (r GetSensorResponse) MarshalJSON() ([]byte, error) {
+	return SensorInfo(r).MarshalJSON()
+}
+
+func (r *GetGatewayDataResponse) UnmarshalJSON(data []byte) error {
+	return (*GatewayData)(r).UnmarshalJSON(data)
+}
+
+func (r GetGatewayDataResponse) MarshalJSON() ([]byte, error) {
+	return GatewayData(r).MarshalJSON()
+}
+
+func (r *GetGatewayPieChartResponse) UnmarshalJSON(data []byte) error {
+	type getGatewayPieChartResponse GetGatewayPieChartResponse
+	var err error
+	r.Extra, err = decodeWithExtra(data, (*getGatewayPieChartResponse)(r))
+	return err
+}
+
+func (r GetGatewayPieChartResponse) MarshalJSON() ([]byte, error) {
+	type getGatewayPieChartResponse GetGatewayPieChartResponse
+	return marshalWithExtra(getGatewayPieChartResponse(r), r.Extra)
+}
+
+func (s *GatewaySettings) UnmarshalJSON(data []byte) error {
+	type gatewaySettings GatewaySettings
+	var err error
+	s.Extra, err = decodeWithExtra(data, (*gatewaySettings)(s))
+	return err
+}
+
+func (s GatewaySettings) MarshalJSON() ([]byte, error) {
+	type gatewaySettings GatewaySettings
+	return marshalWithExtra(gatewaySettings(s), s.Extra)
+}
+
+func (s *TariffSeason) UnmarshalJSON(data []byte) error {
+	type tariffSeason TariffSeason
+	var err error
+	s.Extra, err = decodeWithExtra(data, (*tariffSeason)(s))
+	return err
+}
+
+func (s TariffSeason) MarshalJSON() ([]byte, error) {
+	type tariffSeason TariffSeason
+	return marshalWithExtra(tariffSeason(s), s.Extra)
+}
+
+func (c *TariffChange) UnmarshalJSON(data []byte) error {
+	type tariffChange TariffChange
+	var err error
+	c.Extra, err = decodeWithExtra(data, (*tariffChange)(c))
+	return err
+}
+
+func (c TariffChange) MarshalJSON() ([]byte, error) {
+	type tariffChange TariffChange
+	return marshalWithExtra(tariffChange(c), c.Extra)
+}
+
+func (v *GatewayVersions) UnmarshalJSON(data []byte) error {
+	type gatewayVersions GatewayVersions
+	var err error
+	v.Extra, err = decodeWithExtra(data, (*gatewayVersions)(v))
+	return err
+}
+
+func (v GatewayVersions) MarshalJSON() ([]byte, error) {
+	type gatewayVersions GatewayVersions
+	return marshalWithExtra(gatewayVersions(v), v.Extra)
+}
+
+func (r *GetSensorDataResponse) UnmarshalJSON(data []byte) error {
+	type getSensorDataResponse GetSensorDataResponse
+	var err error
+	r.Extra, err = decodeWithExtra(data, (*getSensorDataResponse)(r))
+	return err
+}
+
+func (r GetSensorDataResponse) MarshalJSON() ([]byte, error) {
+	type getSensorDataResponse GetSensorDataResponse
+	return marshalWithExtra(getSensorDataResponse(r), r.Extra)
+}
+
+func (r *GetSensorConsumptionStatisticsResponse) UnmarshalJSON(data []byte) error {
+	type getSensorConsumptionStatisticsResponse GetSensorConsumptionStatisticsResponse
+	var err error
+	r.Extra, err = decodeWithExtra(data, (*getSensorConsumptionStatisticsResponse)(r))
+	return err
+}
+
+func (r GetSensorConsumptionStatisticsResponse) MarshalJSON() ([]byte, error) {
+	type getSensorConsumptionStatisticsResponse GetSensorConsumptionStatisticsResponse
+	return marshalWithExtra(getSensorConsumptionStatisticsResponse(r), r.Extra)
+}
+
+func (s *SensorConsumption) UnmarshalJSON(data []byte) error {
+	type sensorConsumption SensorConsumption
+	var err error
+	s.Extra, err = decodeWithExtra(data, (*sensorConsumption)(s))
+	return err
+}
+
+func (s SensorConsumption) MarshalJSON() ([]byte, error) {
+	type sensorConsumption SensorConsumption
+	return marshalWithExtra(sensorConsumption(s), s.Extra)
+}
+
+func (r *GetGatewayConsumptionStatisticsResponse) UnmarshalJSON(data []byte) error {
+	type getGatewayConsumptionStatisticsResponse GetGatewayConsumptionStatisticsResponse
+	var err error
+	r.Extra, err = decodeWithExtra(data, (*getGatewayConsumptionStatisticsResponse)(r))
+	return err
+}
+
+func (r GetGatewayConsumptionStatisticsResponse) MarshalJSON() ([]byte, error) {
+	type getGatewayConsumptionStatisticsResponse GetGatewayConsumptionStatisticsResponse
+	return marshalWithExtra(getGatewayConsumptionStatisticsResponse(r), r.Extra)
+}
+
+func (g *GatewayConsumption) UnmarshalJSON(data []byte) error {
+	type gatewayConsumption GatewayConsumption
+	var err error
+	g.Extra, err = decodeWithExtra(data, (*gatewayConsumption)(g))
+	return err
+}
+
+func (g GatewayConsumption) MarshalJSON() ([]byte, error) {
+	type gatewayConsumption GatewayConsumption
+	return marshalWithExtra(gatewayConsumption(g), g.Extra)
+}
+
+func (b *PieChartBattery) UnmarshalJSON(data []byte) error {
+	type pieChartBattery PieChartBattery
+	var err error
+	b.Extra, err = decodeWithExtra(data, (*pieChartBattery)(b))
+	return err
+}
+
+func (b PieChartBattery) MarshalJSON() ([]byte, error) {
+	type pieChartBattery PieChartBattery
+	return marshalWithExtra(pieChartBattery(b), b.Extra)
+}
+
+func (a *PieChartArrow) UnmarshalJSON(data []byte) error {
+	type pieChartArrow PieChartArrow
+	var err error
+	a.Extra, err = decodeWithExtra(data, (*pieChartArrow)(a))
+	return err
+}
+
+func (a PieChartArrow) MarshalJSON() ([]byte, error) {
+	type pieChartArrow PieChartArrow
+	return marshalWithExtra(pieChartArrow(a), a.Extra)
+}
+
+func (f *ForecastEntry) UnmarshalJSON(data []byte) error {
+	type forecastEntry ForecastEntry
+	var err error
+	f.Extra, err = decodeWithExtra(data, (*forecastEntry)(f))
+	return err
+}
+
+func (f ForecastEntry) MarshalJSON() ([]byte, error) {
+	type forecastEntry ForecastEntry
+	return marshalWithExtra(forecastEntry(f), f.Extra)
+}
+
+func (r *GetLowRateTariffResponse) UnmarshalJSON(data []byte) error {
+	type getLowRateTariffResponse GetLowRateTariffResponse
+	var err error
+	r.Extra, err = decodeWithExtra(data, (*getLowRateTariffResponse)(r))
+	return err
+}
+
+func (r GetLowRateTariffResponse) MarshalJSON() ([]byte, error) {
+	type getLowRateTariffResponse GetLowRateTariffResponse
+	return marshalWithExtra(getLowRateTariffResponse(r), r.Extra)
+}
@@ -0,0 +1,130 @@
+package solarmanager
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultPageSize is the page size used by the list methods if
+// ListOptions.PageSize is 0.
+const DefaultPageSize = 100
+
+// ListOptions configures the pagination of list methods.
+type ListOptions struct {
+	// PageSize is the number of items requested per page.
+	PageSize int
+}
+
+// Iterator iterates over the items of a paginated listing, fetching further
+// pages as needed. The listing ends with the first page that has fewer items
+// than the page size, so a server that ignores the page parameter and always
+// returns full pages is iterated until ctx is done.
+//
+//	it := client.ListGateways(ctx, nil)
+//	for it.Next() {
+//		fmt.Println(it.Value().SmId)
+//	}
+//	if err := it.Err(); err != nil {
+//		// ...
+//	}
+type Iterator[T any] struct {
+	ctx      context.Context
+	fetch    func(ctx context.Context, page, pageSize int) ([]T, error)
+	pageSize int
+	page     int // next page to fetch, starting at 1
+	items    []T // remaining items of the current page
+	value    T
+	done     bool // the last page has been fetched
+	err      error
+}
+
+// NewIterator returns an iterator over the pages returned by fetch, e.g. for
+// fakes of the list methods. Pages are numbered from 1.
+func NewIterator[T any](ctx context.Context, opts *ListOptions, fetch func(ctx context.Context, page, pageSize int) ([]T, error)) *Iterator[T] {
+	pageSize := DefaultPageSize
+	if opts != nil && opts.PageSize > 0 {
+		pageSize = opts.PageSize
+	}
+	return &Iterator[T]{ctx: ctx, fetch: fetch, pageSize: pageSize, page: 1}
+}
+
+// Next advances to the next item, which is then available through Value. It
+// returns false when there are no more items or an error occurred.
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		items, err := it.fetch(it.ctx, it.page, it.pageSize)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		// A short or empty page is the last one.
+		it.done = len(items) < it.pageSize
+		it.page++
+		it.items = items
+	}
+	it.value, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All returns the remaining items.
+func (it *Iterator[T]) All() ([]T, error) {
+	var items []T
+	for it.Next() {
+		items = append(items, it.Value())
+	}
+	return items, it.Err()
+}
+
+// ListUsers iterates over the users visible to an installer or OEM account.
+//
+// The endpoint is not part of the public API documentation and has not been
+// checked against a live installer account. It is assumed to be
+// GET v1/users?page=<n>&limit=<size> with 1-based pages, returning a plain
+// JSON array of user objects like the "user" member of GetGatewayInfo, and no
+// total count.
+func (c *Client) ListUsers(ctx context.Context, opts *ListOptions) *Iterator[User] {
+	return NewIterator(ctx, opts, func(ctx context.Context, page, pageSize int) ([]User, error) {
+		u := fmt.Sprintf("v1/users?page=%d&limit=%d", page, pageSize)
+
+		var response []User
+		req, err := c.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.do(ctx, Operation{Name: "ListUsers", Params: ListParams{Page: page, PageSize: pageSize}}, req, &response)
+		return response, err
+	})
+}
+
+// ListGateways iterates over the gateways visible to an installer or OEM
+// account, e.g. to discover SolarManager IDs.
+//
+// Like ListUsers, the endpoint has not been checked against a live account.
+// It is assumed to be GET v1/gateways?page=<n>&limit=<size>, returning a plain
+// JSON array of objects like the "gateway" member of GetGatewayInfo.
+func (c *Client) ListGateways(ctx context.Context, opts *ListOptions) *Iterator[GatewayInfo] {
+	return NewIterator(ctx, opts, func(ctx context.Context, page, pageSize int) ([]GatewayInfo, error) {
+		u := fmt.Sprintf("v1/gateways?page=%d&limit=%d", page, pageSize)
+
+		var response []GatewayInfo
+		req, err := c.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.do(ctx, Operation{Name: "ListGateways", Params: ListParams{Page: page, PageSize: pageSize}}, req, &response)
+		return response, err
+	})
+}
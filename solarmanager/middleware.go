@@ -0,0 +1,220 @@
+package solarmanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// Operation describes an API call.
+type Operation struct {
+	// Name is the name of the Client method, e.g. "GetGatewayData".
+	Name string
+	// Params holds the parameters of the call: GatewayParams,
+	// SensorParams, StatisticsParams or ListParams.
+	Params interface{}
+}
+
+// GatewayParams are the parameters of calls for a single gateway, e.g.
+// GetGatewayData.
+type GatewayParams struct {
+	SmID string
+}
+
+// SensorParams are the parameters of GetSensor and GetSensorData. SmID is
+// empty for GetSensor.
+type SensorParams struct {
+	SmID     string
+	SensorID string
+}
+
+// StatisticsParams are the parameters of GetGatewayConsumptionStatistics
+// and GetSensorConsumptionStatistics. Either SmID or SensorID is set.
+type StatisticsParams struct {
+	SmID     string
+	SensorID string
+	Period   StatisticPeriod
+}
+
+// ListParams are the parameters of a page fetched by ListUsers or
+// ListGateways.
+type ListParams struct {
+	Page     int
+	PageSize int
+}
+
+// ids returns the SolarManager and sensor ID of the call, if any.
+func (op Operation) ids() (smID, sensorID string) {
+	switch p := op.Params.(type) {
+	case GatewayParams:
+		return p.SmID, ""
+	case SensorParams:
+		return p.SmID, p.SensorID
+	case StatisticsParams:
+		return p.SmID, p.SensorID
+	}
+	return "", ""
+}
+
+// Handler sends the request of an API call and returns the response. An
+// error is returned for responses with a status code outside the 200 range,
+// as by CheckResponse. The response body is closed by the caller.
+type Handler func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error)
+
+// Middleware wraps a Handler, e.g. to modify requests, observe responses or
+// return responses without sending the request.
+type Middleware func(next Handler) Handler
+
+// Use adds middleware to the client. Middleware runs in the order it was
+// added, so the first one sees the request first and the response last. It
+// sees every API call once, even if it is retried. Use must not be called
+// concurrently with requests.
+func (c *Client) Use(mw ...Middleware) {
+	c.middleware = append(c.middleware, mw...)
+}
+
+// Hooks is a simpler alternative to Middleware. Unset hooks are ignored.
+type Hooks struct {
+	// BeforeRequest is called before the request is sent and may modify it.
+	// If it returns a response, e.g. from a cache, the request is not sent
+	// and that response is used instead. If it returns an error, the call
+	// fails with it.
+	BeforeRequest func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error)
+	// AfterResponse is called with successful responses.
+	AfterResponse func(ctx context.Context, op Operation, req *http.Request, resp *http.Response)
+	// OnError is called if the call fails, including unsuccessful
+	// responses.
+	OnError func(ctx context.Context, op Operation, req *http.Request, err error)
+}
+
+// Middleware returns a Middleware calling the hooks.
+func (h Hooks) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+			var resp *http.Response
+			var err error
+			if h.BeforeRequest != nil {
+				resp, err = h.BeforeRequest(ctx, op, req)
+			}
+			if resp == nil && err == nil {
+				resp, err = next(ctx, op, req)
+			}
+			if err != nil {
+				if h.OnError != nil {
+					h.OnError(ctx, op, req, err)
+				}
+				return resp, err
+			}
+			if h.AfterResponse != nil {
+				h.AfterResponse(ctx, op, req, resp)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// handler returns the middleware chain of the client. Retries, logging
+// and telemetry are implemented as middleware, too.
+func (c *Client) handler() Handler {
+	var chain []Middleware
+	if c.telemetry != nil {
+		chain = append(chain, c.telemetry.middleware)
+	}
+	chain = append(chain, c.middleware...)
+	chain = append(chain, c.retry, checkResponse, c.dump)
+	h := Handler(c.transport)
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
+
+// transport sends req once, waiting for the Limiter first and retrying once
+// with refreshed credentials if it is rejected.
+func (c *Client) transport(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := c.Authenticator.(Refresher); ok && resp.StatusCode == http.StatusUnauthorized && replayable(req) {
+		resp.Body.Close()
+		if err := r.Refresh(ctx, req); err != nil {
+			return nil, err
+		}
+		retry, err := replay(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return c.send(ctx, retry)
+	}
+	return resp, nil
+}
+
+// dump logs requests and responses in Verbose mode.
+func (c *Client) dump(next Handler) Handler {
+	return func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+		if !c.Verbose {
+			return next(ctx, op, req)
+		}
+		if d, err := httputil.DumpRequestOut(req, true); err == nil {
+			c.logf("%s", d)
+		}
+		resp, err := next(ctx, op, req)
+		if resp != nil {
+			if d, err := httputil.DumpResponse(resp, true); err == nil {
+				c.logf("%s", d)
+			}
+		}
+		return resp, err
+	}
+}
+
+// checkResponse turns unsuccessful responses into errors.
+func checkResponse(next Handler) Handler {
+	return func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+		resp, err := next(ctx, op, req)
+		if err != nil {
+			return resp, err
+		}
+		return resp, CheckResponse(resp)
+	}
+}
+
+// retry retries failed requests according to the Retry policy.
+func (c *Client) retry(next Handler) Handler {
+	return func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+		resp, err := next(ctx, op, req)
+		for n := 1; ; n++ {
+			delay, ok := c.Retry.delay(n, req, err)
+			if !ok {
+				return resp, err
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if c.Verbose {
+				c.logf("retrying %s %s in %v (attempt %d)", req.Method, req.URL, delay, n+1)
+			}
+			addRetryEvent(ctx, n, delay, err)
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, ctx.Err()
+			}
+			retry, rerr := replay(ctx, req)
+			if rerr != nil {
+				return nil, rerr
+			}
+			resp, err = next(ctx, op, retry)
+		}
+	}
+}
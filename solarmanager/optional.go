@@ -0,0 +1,91 @@
+package solarmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// Optional is a JSON value that may be absent, null or set, so that e.g. a
+// reported power of 0 W can be told apart from a device not reporting power
+// at all. The zero value is absent. Absent members are omitted when the
+// containing response type is marshalled, null ones are marshalled as null.
+type Optional[T any] struct {
+	Value T
+	Set   bool // the member was present with a non-null value
+	Null  bool // the member was present with a null value
+}
+
+// Some returns an Optional set to v.
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{Value: v, Set: true}
+}
+
+// Null returns an Optional that is explicitly null.
+func Null[T any]() Optional[T] {
+	return Optional[T]{Null: true}
+}
+
+// Get returns the value and whether it is set.
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Set
+}
+
+// Or returns the value if it is set and def otherwise.
+func (o Optional[T]) Or(def T) T {
+	if o.Set {
+		return o.Value
+	}
+	return def
+}
+
+// IsZero reports whether the value is absent.
+func (o Optional[T]) IsZero() bool {
+	return !o.Set && !o.Null
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.Set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	var zero T
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*o = Optional[T]{Value: zero, Null: true}
+		return nil
+	}
+	var v T
+	if d, ok := interface{}(&v).(numberDecoder); ok {
+		set, err := d.decode(data)
+		if set {
+			*o = Some(v)
+		}
+		return err
+	}
+	err := json.Unmarshal(data, &v)
+	var mismatch *json.UnmarshalTypeError
+	if errors.As(err, &mismatch) {
+		// Leave o unchanged like a mismatched plain field, instead of
+		// aborting the enclosing object; see decodeWithExtra.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	*o = Some(v)
+	return nil
+}
+
+// valueType is used by the schema checker to look inside Optional values.
+func (o Optional[T]) valueType() reflect.Type {
+	return reflect.TypeOf(&o.Value).Elem()
+}
+
+type optional interface {
+	IsZero() bool
+	valueType() reflect.Type
+}
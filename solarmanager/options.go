@@ -0,0 +1,251 @@
+package solarmanager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a Client created by NewClientWithOptions.
+type Option func(o *options) error
+
+type options struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	timeout    time.Duration
+	userAgent  string
+	logger     *log.Logger
+	retry      RetryPolicy
+	limiter    Limiter
+	telemetry  *telemetry
+	middleware []Middleware
+
+	username, password string
+	authenticator      Authenticator
+	auth               func(c *Client) Authenticator
+	authOptions        int // number of authentication options
+}
+
+// NewClientWithOptions returns a new SolarManager API client. Without
+// options, it is equivalent to NewClient(nil, nil, "", ""). An error is
+// returned if an option is invalid or more than one authentication option
+// is given.
+func NewClientWithOptions(opts ...Option) (*Client, error) {
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, fmt.Errorf("solarmanager: %w", err)
+		}
+	}
+	if o.authOptions > 1 {
+		return nil, errors.New("solarmanager: more than one authentication option")
+	}
+	return newClient(&o), nil
+}
+
+func newClient(o *options) *Client {
+	httpClient := o.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	if o.timeout > 0 {
+		// Don't modify the caller's client.
+		hc := *httpClient
+		hc.Timeout = o.timeout
+		httpClient = &hc
+	}
+	baseURL := o.baseURL
+	if baseURL == nil {
+		baseURL, _ = url.Parse(defaultBaseURL)
+	}
+	ua := userAgent
+	if o.userAgent != "" {
+		ua = o.userAgent + " " + userAgent
+	}
+
+	c := &Client{
+		client:        httpClient,
+		BaseURL:       baseURL,
+		UserAgent:     ua,
+		Username:      o.username,
+		Password:      o.password,
+		Authenticator: o.authenticator,
+		Retry:         o.retry,
+		Logger:        o.logger,
+		Limiter:       o.limiter,
+		telemetry:     o.telemetry,
+		middleware:    o.middleware,
+	}
+	if o.auth != nil {
+		c.Authenticator = o.auth(c)
+	}
+	return c
+}
+
+// WithBaseURL sets the API base URL, which must be an absolute HTTP or
+// HTTPS URL. A trailing slash is added to its path if missing.
+func WithBaseURL(rawURL string) Option {
+	return func(o *options) error {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("invalid base URL: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid base URL %q: must be an absolute HTTP or HTTPS URL", rawURL)
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		o.baseURL = u
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) error {
+		if httpClient == nil {
+			return errors.New("nil HTTP client")
+		}
+		o.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithBasicAuth authenticates requests with HTTP Basic authentication.
+func WithBasicAuth(username, password string) Option {
+	return func(o *options) error {
+		if username == "" || password == "" {
+			return errors.New("empty username or password")
+		}
+		o.username, o.password = username, password
+		o.authOptions++
+		return nil
+	}
+}
+
+// WithAuthenticator authenticates requests with a.
+func WithAuthenticator(a Authenticator) Option {
+	return func(o *options) error {
+		if a == nil {
+			return errors.New("nil Authenticator")
+		}
+		o.authenticator = a
+		o.authOptions++
+		return nil
+	}
+}
+
+// WithTokenAuth authenticates requests with a TokenAuth, which persists its
+// token in store unless it is nil.
+func WithTokenAuth(email, password string, store TokenStore) Option {
+	return func(o *options) error {
+		if email == "" || password == "" {
+			return errors.New("empty email or password")
+		}
+		o.auth = func(c *Client) Authenticator {
+			a := NewTokenAuth(c, email, password)
+			a.Store = store
+			return a
+		}
+		o.authOptions++
+		return nil
+	}
+}
+
+// WithTimeout sets the time limit for requests, including reading the
+// response body. It applies to a copy of the HTTP client set by
+// WithHTTPClient.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid timeout %v", d)
+		}
+		o.timeout = d
+		return nil
+	}
+}
+
+// WithUserAgent prepends product, e.g. "myapp/1.2", to the User-Agent
+// header of requests.
+func WithUserAgent(product string) Option {
+	return func(o *options) error {
+		if product == "" || strings.ContainsAny(product, "\r\n") {
+			return fmt.Errorf("invalid user agent %q", product)
+		}
+		o.userAgent = product
+		return nil
+	}
+}
+
+// WithLogger sets the logger receiving the output of Verbose mode.
+func WithLogger(l *log.Logger) Option {
+	return func(o *options) error {
+		if l == nil {
+			return errors.New("nil Logger")
+		}
+		o.logger = l
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the retry policy, e.g. DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) error {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("invalid retry policy: %w", err)
+		}
+		o.retry = p
+		return nil
+	}
+}
+
+// WithLimiter sets the Limiter waited on before every request.
+func WithLimiter(l Limiter) Option {
+	return func(o *options) error {
+		if l == nil {
+			return errors.New("nil Limiter")
+		}
+		o.limiter = l
+		return nil
+	}
+}
+
+// WithMiddleware adds middleware to the client, as by Client.Use.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(o *options) error {
+		for _, m := range mw {
+			if m == nil {
+				return errors.New("nil Middleware")
+			}
+		}
+		o.middleware = append(o.middleware, mw...)
+		return nil
+	}
+}
+
+// WithOpenTelemetry instruments the client. Every API call is traced as a
+// client span named after the Client method, e.g. "GetGatewayData", with
+// the SolarManager and sensor ID, the HTTP status and an event per retry as
+// attributes. The duration and errors of calls are recorded as the metrics
+// solarmanager.client.request.duration and
+// solarmanager.client.request.errors with the operation, HTTP method,
+// status and error type as attributes, but not the IDs. If tp or mp is nil,
+// the global provider is used.
+func WithOpenTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) Option {
+	return func(o *options) error {
+		t, err := newTelemetry(tp, mp)
+		if err != nil {
+			return err
+		}
+		o.telemetry = t
+		return nil
+	}
+}
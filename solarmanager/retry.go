@@ -0,0 +1,106 @@
+package solarmanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures the retry of requests that fail with a network
+// error or a 429, 502, 503 or 504 response. Only requests with idempotent
+// methods and a replayable body are retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. If it is
+	// 0, requests are not retried.
+	MaxRetries int
+	// MinBackoff is the delay before the first retry. It is doubled for
+	// every further retry, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is a reasonable policy for unattended polling.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 500 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+}
+
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.MaxRetries < 0:
+		return errors.New("negative MaxRetries")
+	case p.MinBackoff < 0 || p.MaxBackoff < 0:
+		return errors.New("negative backoff")
+	case p.MaxBackoff > 0 && p.MinBackoff > p.MaxBackoff:
+		return errors.New("MinBackoff exceeds MaxBackoff")
+	}
+	return nil
+}
+
+// delay returns how long to wait before retry n (starting at 1) of req,
+// which failed with err, and whether to retry at all. A Retry-After header
+// is honored, unless it exceeds MaxBackoff.
+func (p RetryPolicy) delay(n int, req *http.Request, err error) (time.Duration, bool) {
+	if err == nil || n > p.MaxRetries || !replayable(req) {
+		return 0, false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+	default:
+		return 0, false
+	}
+
+	var resp *http.Response
+	var errorResponse *ErrorResponse
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &errorResponse):
+		resp = errorResponse.Response
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return 0, false
+		}
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return 0, false
+	case !errors.As(err, &urlErr):
+		// Only transport errors are transient, not those of the Limiter
+		// or the Authenticator.
+		return 0, false
+	}
+
+	d := p.MinBackoff
+	for i := 1; i < n && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if resp != nil {
+		if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if p.MaxBackoff > 0 && after > p.MaxBackoff {
+				return 0, false
+			}
+			d = max(d, after)
+		}
+	}
+	return d, true
+}
+
+// retryAfter parses the value of a Retry-After header.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,258 @@
+package solarmanager
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaWarningKind describes how a response deviates from the Go types.
+type SchemaWarningKind int
+
+const (
+	// UnknownField is reported for JSON object keys without a matching
+	// struct field. Their values are dropped during decoding, unless the
+	// type keeps them in an Extra field.
+	UnknownField SchemaWarningKind = iota
+	// TypeMismatch is reported for JSON values that cannot be decoded into
+	// the Go type of the corresponding field, which is left unchanged.
+	TypeMismatch
+)
+
+func (k SchemaWarningKind) String() string {
+	switch k {
+	case UnknownField:
+		return "unknown field"
+	case TypeMismatch:
+		return "type mismatch"
+	default:
+		return "SchemaWarningKind(" + strconv.Itoa(int(k)) + ")"
+	}
+}
+
+// SchemaWarning reports a difference between an API response and the Go type
+// it is decoded into, which usually means that the API has changed.
+type SchemaWarning struct {
+	Method string
+	URL    string
+	Kind   SchemaWarningKind
+	Path   string          // location in the response, e.g. "devices[2].currentPower"
+	Value  json.RawMessage // the offending JSON value
+	GoType string          // the Go type expected at Path, empty for unknown fields
+}
+
+func (w SchemaWarning) String() string {
+	if w.Kind == UnknownField {
+		return fmt.Sprintf("%s %s: unknown field %s: %s", w.Method, w.URL, w.Path, w.Value)
+	}
+	return fmt.Sprintf("%s %s: cannot decode %s at %s into %s", w.Method, w.URL, w.Value, w.Path, w.GoType)
+}
+
+var (
+	wattType            = reflect.TypeOf(Watt(0))
+	wattHourType        = reflect.TypeOf(WattHour(0))
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// checkSchema compares the JSON document data with the Go type t and calls
+// report for every unknown field and type mismatch.
+func checkSchema(data []byte, t reflect.Type, report func(kind SchemaWarningKind, path string, value json.RawMessage, goType reflect.Type)) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return
+	}
+
+	var walk func(path string, v interface{}, t reflect.Type)
+	mismatch := func(path string, v interface{}, t reflect.Type) {
+		raw, _ := json.Marshal(v)
+		report(TypeMismatch, path, raw, t)
+	}
+	walk = func(path string, v interface{}, t reflect.Type) {
+		if v == nil {
+			return
+		}
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if o, ok := reflect.Zero(t).Interface().(optional); ok {
+			walk(path, v, o.valueType())
+			return
+		}
+		if t == wattType || t == wattHourType {
+			if _, ok := parseNumber(v); !ok {
+				mismatch(path, v, t)
+			}
+			return
+		}
+		// Types with custom decoding, e.g. time.Time, are trusted, unless
+		// they only decode unmodelled members into an Extra field.
+		if reflect.PointerTo(t).Implements(jsonUnmarshalerType) && !hasExtra(t) {
+			return
+		}
+		if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+			if _, ok := v.(string); !ok {
+				mismatch(path, v, t)
+			}
+			return
+		}
+
+		switch t.Kind() {
+		case reflect.Interface:
+		case reflect.Struct:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				mismatch(path, v, t)
+				return
+			}
+			fields := jsonFields(t)
+			for key, value := range obj {
+				f, ok := fields[key]
+				if !ok {
+					// encoding/json falls back to case-insensitive matching.
+					for name, field := range fields {
+						if strings.EqualFold(name, key) {
+							f, ok = field, true
+							break
+						}
+					}
+				}
+				if !ok {
+					raw, _ := json.Marshal(value)
+					report(UnknownField, joinPath(path, key), raw, nil)
+					continue
+				}
+				walk(joinPath(path, key), value, f.Type)
+			}
+		case reflect.Map:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				mismatch(path, v, t)
+				return
+			}
+			for key, value := range obj {
+				walk(joinPath(path, key), value, t.Elem())
+			}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				if _, ok := v.(string); !ok {
+					mismatch(path, v, t)
+				}
+				return
+			}
+			arr, ok := v.([]interface{})
+			if !ok {
+				mismatch(path, v, t)
+				return
+			}
+			for i, e := range arr {
+				walk(fmt.Sprintf("%s[%d]", path, i), e, t.Elem())
+			}
+		case reflect.String:
+			if _, ok := v.(string); !ok {
+				mismatch(path, v, t)
+			}
+		case reflect.Bool:
+			if _, ok := v.(bool); !ok {
+				mismatch(path, v, t)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, ok := v.(json.Number)
+			if !ok {
+				mismatch(path, v, t)
+			} else if _, err := strconv.ParseInt(string(n), 10, t.Bits()); err != nil {
+				mismatch(path, v, t)
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, ok := v.(json.Number)
+			if !ok {
+				mismatch(path, v, t)
+			} else if _, err := strconv.ParseUint(string(n), 10, t.Bits()); err != nil {
+				mismatch(path, v, t)
+			}
+		case reflect.Float32, reflect.Float64:
+			if _, ok := v.(json.Number); !ok {
+				mismatch(path, v, t)
+			}
+		}
+	}
+	walk("", v, t)
+}
+
+// typeError describes the mismatch of value at path in a document decoded into
+// top the way encoding/json does.
+func typeError(top reflect.Type, path string, value json.RawMessage, t reflect.Type) *json.UnmarshalTypeError {
+	for top.Kind() == reflect.Pointer {
+		top = top.Elem()
+	}
+	desc := "number " + string(value)
+	switch {
+	case len(value) == 0:
+	case value[0] == '"':
+		desc = "string"
+	case value[0] == '{':
+		desc = "object"
+	case value[0] == '[':
+		desc = "array"
+	case value[0] == 't' || value[0] == 'f':
+		desc = "bool"
+	}
+	return &json.UnmarshalTypeError{Value: desc, Type: t, Struct: top.Name(), Field: path}
+}
+
+func hasExtra(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	f, ok := t.FieldByName("Extra")
+	return ok && f.Type == reflect.TypeOf(map[string]json.RawMessage(nil))
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonFields returns the struct fields of t keyed by their JSON name,
+// including those of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, ef := range jsonFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = ef
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
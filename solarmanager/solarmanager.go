@@ -1,6 +1,8 @@
 package solarmanager
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"time"
@@ -17,6 +19,8 @@ type GatewayInfo struct {
 	LastErrorDate           time.Time `json:"lastErrorDate"` // date of last error
 	Mac                     string    `json:"mac"`           // gateway mac address
 	Ip                      string    `json:"ip"`            // gateway ip
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type SensorInfo struct {
@@ -33,99 +37,109 @@ type SensorInfo struct {
 	} `json:"tag"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+type User struct {
+	FirstName    string `json:"first_name"`
+	UserId       string `json:"user_id"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	Status       string `json:"status"`
+	Country      string `json:"country"`
+	City         string `json:"city"`
+	Zip          string `json:"zip"`
+	Plant        string `json:"plant"`
+	CompanyName  string `json:"company_name"`
+	Company      string `json:"company"`      // installer company
+	ConnectedOem string `json:"connectedOem"` // OEM the user is connected to
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type SensorData struct {
-	Id                    string `json:"_id"`
-	AccumulatedErrorCount int    `json:"accumulatedErrorCount"`
-	CurrentPowerInvSm     int    `json:"currentPowerInvSm,omitempty"`
-	CurrentEnergy         int    `json:"currentEnergy,omitempty"`
-	Errors                []int  `json:"errors"`
-	Signal                string `json:"signal"`
-	ActiveDevice          int    `json:"activeDevice,omitempty"`
-	CurrentPower          int    `json:"currentPower,omitempty"`
-	SwitchState           int    `json:"switchState,omitempty"`
-	CurrentWaterTemp      int    `json:"currentWaterTemp,omitempty"`
-	Status                int    `json:"status,omitempty"`
-	SOC                   int    `json:"SOC,omitempty"`
+	Id                    string             `json:"_id"`
+	AccumulatedErrorCount int                `json:"accumulatedErrorCount"`
+	CurrentPowerInvSm     Optional[Watt]     `json:"currentPowerInvSm"`
+	CurrentEnergy         Optional[WattHour] `json:"currentEnergy"`
+	Errors                []int              `json:"errors"`
+	Signal                string             `json:"signal"`
+	ActiveDevice          Optional[int]      `json:"activeDevice"`
+	CurrentPower          Optional[Watt]     `json:"currentPower"`
+	SwitchState           Optional[int]      `json:"switchState"`
+	CurrentWaterTemp      Optional[int]      `json:"currentWaterTemp"`
+	Status                Optional[int]      `json:"status"`
+	SOC                   Optional[int]      `json:"SOC"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type GatewayData struct {
 	InterfaceVersion              string       `json:"Interface Version"`
 	TimeStamp                     time.Time    `json:"TimeStamp"`
-	CurrentBatteryChargeDischarge int          `json:"currentBatteryChargeDischarge"`
-	CurrentPowerConsumption       int          `json:"currentPowerConsumption"`
-	CurrentPvGeneration           int          `json:"currentPvGeneration"`
+	CurrentBatteryChargeDischarge Watt         `json:"currentBatteryChargeDischarge"`
+	CurrentPowerConsumption       Watt         `json:"currentPowerConsumption"`
+	CurrentPvGeneration           Watt         `json:"currentPvGeneration"`
 	Devices                       []SensorData `json:"devices"`
 	Errors                        []int        `json:"errors"`
 	Soc                           int          `json:"soc"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type GetGatewayInfoResponse struct {
-	Gateway GatewayInfo `json:"gateway"`
-
-	Settings struct {
-		OffsetWatt     int     `json:"offset_watt"`
-		LowMFFrom      string  `json:"low_m_f_from"`
-		LowMFTo        string  `json:"low_m_f_to"`
-		LowSatFrom     string  `json:"low_sat_from"`
-		LowSatTo       string  `json:"low_sat_to"`
-		LowSunFrom     string  `json:"low_sun_from"`
-		LowSunTo       string  `json:"low_sun_to"`
-		KWp            float64 `json:"kWp"`
-		HouseFuse      int     `json:"houseFuse"`
-		LoadManagement bool    `json:"loadManagement"`
-		CommonSeasons  struct {
-			MondayFriday []struct {
-				From   string `json:"from"`
-				Tariff string `json:"tariff"`
-			} `json:"mondayFriday"`
-			Saturday []struct {
-				From   string `json:"from"`
-				Tariff string `json:"tariff"`
-			} `json:"saturday"`
-			Sunday []struct {
-				From   string `json:"from"`
-				Tariff string `json:"tariff"`
-			} `json:"sunday"`
-		} `json:"commonSeasons"`
-		HighTariff          float64 `json:"highTariff"`
-		IsWinterTimeEnabled bool    `json:"isWinterTimeEnabled"`
-		LowTariff           float64 `json:"lowTariff"`
-		Provider            string  `json:"provider"`
-		TariffType          string  `json:"tariffType"`
-		WinterSeason        struct {
-			MondayFriday []struct {
-				From   string `json:"from"`
-				Tariff string `json:"tariff"`
-			} `json:"mondayFriday"`
-			Saturday []struct {
-				From   string `json:"from"`
-				Tariff string `json:"tariff"`
-			} `json:"saturday"`
-			Sunday []struct {
-				From   string `json:"from"`
-				Tariff string `json:"tariff"`
-			} `json:"sunday"`
-		} `json:"winterSeason"`
-	} `json:"settings"`
-	User struct {
-		FirstName    string `json:"first_name"`
-		UserId       string `json:"user_id"`
-		LastName     string `json:"last_name"`
-		Email        string `json:"email"`
-		Status       string `json:"status"`
-		Country      string `json:"country"`
-		City         string `json:"city"`
-		Zip          string `json:"zip"`
-		Plant        string `json:"plant"`
-		CompanyName  string `json:"company_name"`
-		Company      string `json:"company"`
-		ConnectedOem string `json:"connectedOem"`
-	} `json:"user"`
-	Versions struct {
-		SupportContract bool `json:"supportContract"`
-	} `json:"versions"`
+	Gateway  GatewayInfo     `json:"gateway"`
+	Settings GatewaySettings `json:"settings"`
+	User     User            `json:"user"`
+	Versions GatewayVersions `json:"versions"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+type GatewaySettings struct {
+	OffsetWatt          int              `json:"offset_watt"`
+	LowMFFrom           string           `json:"low_m_f_from"`
+	LowMFTo             string           `json:"low_m_f_to"`
+	LowSatFrom          string           `json:"low_sat_from"`
+	LowSatTo            string           `json:"low_sat_to"`
+	LowSunFrom          string           `json:"low_sun_from"`
+	LowSunTo            string           `json:"low_sun_to"`
+	KWp                 float64          `json:"kWp"`
+	HouseFuse           int              `json:"houseFuse"`
+	LoadManagement      bool             `json:"loadManagement"`
+	CommonSeasons       TariffSeason     `json:"commonSeasons"`
+	HighTariff          float64          `json:"highTariff"`
+	IsWinterTimeEnabled bool             `json:"isWinterTimeEnabled"`
+	LowTariff           float64          `json:"lowTariff"`
+	Provider            Optional[string] `json:"provider"`
+	TariffType          string           `json:"tariffType"`
+	WinterSeason        TariffSeason     `json:"winterSeason"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+// TariffSeason lists the tariff changes of each kind of day in a season.
+type TariffSeason struct {
+	MondayFriday []TariffChange `json:"mondayFriday"`
+	Saturday     []TariffChange `json:"saturday"`
+	Sunday       []TariffChange `json:"sunday"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+// TariffChange is the tariff in effect from a time of day.
+type TariffChange struct {
+	From   string `json:"from"`
+	Tariff string `json:"tariff"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+type GatewayVersions struct {
+	SupportContract bool `json:"supportContract"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type GetSensorsResponse []SensorInfo
@@ -137,49 +151,78 @@ type GetGatewayDataResponse GatewayData
 type GetSensorDataResponse struct {
 	Date time.Time  `json:"date"`
 	Data SensorData `json:"data"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type GetSensorConsumptionStatisticsResponse struct {
-	SensorId string `json:"sensorId"`
-	Period   string `json:"period"`
-	Data     []struct {
-		CreatedAt   string  `json:"createdAt"`
-		Consumption float64 `json:"consumption"`
-	} `json:"data"`
-	TotalConsumption float64 `json:"totalConsumption"`
+	SensorId         string              `json:"sensorId"`
+	Period           string              `json:"period"`
+	Data             []SensorConsumption `json:"data"`
+	TotalConsumption WattHour            `json:"totalConsumption"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+// SensorConsumption is an entry of the sensor consumption statistics.
+type SensorConsumption struct {
+	CreatedAt   string   `json:"createdAt"`
+	Consumption WattHour `json:"consumption"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type GetGatewayConsumptionStatisticsResponse struct {
-	GatewayId string `json:"gatewayId"`
-	Period    string `json:"period"`
-	Data      []struct {
-		CreatedAt   string `json:"createdAt"`
-		Consumption int    `json:"consumption"`
-		Production  int    `json:"production"`
-	} `json:"data"`
-	TotalConsumption int `json:"totalConsumption"`
+	GatewayId        string               `json:"gatewayId"`
+	Period           string               `json:"period"`
+	Data             []GatewayConsumption `json:"data"`
+	TotalConsumption WattHour             `json:"totalConsumption"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+// GatewayConsumption is an entry of the gateway consumption statistics.
+type GatewayConsumption struct {
+	CreatedAt   string   `json:"createdAt"`
+	Consumption WattHour `json:"consumption"`
+	Production  WattHour `json:"production"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type GetGatewayPieChartResponse struct {
-	LastUpdate  time.Time `json:"lastUpdate"`
-	Production  int       `json:"production"`
-	Consumption int       `json:"consumption"`
-	Battery     struct {
-		Capacity           int `json:"capacity"`
-		BatteryCharging    int `json:"batteryCharging"`
-		BatteryDischarging int `json:"batteryDischarging"`
-	} `json:"battery"`
-	Arrows []struct {
-		Direction string `json:"direction"`
-		Value     int    `json:"value"`
-	} `json:"arrows"`
+	LastUpdate  time.Time       `json:"lastUpdate"`
+	Production  Watt            `json:"production"`
+	Consumption Watt            `json:"consumption"`
+	Battery     PieChartBattery `json:"battery"`
+	Arrows      []PieChartArrow `json:"arrows"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+type PieChartBattery struct {
+	Capacity           int  `json:"capacity"`
+	BatteryCharging    Watt `json:"batteryCharging"`
+	BatteryDischarging Watt `json:"batteryDischarging"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
+}
+
+// PieChartArrow is a power flow of the pie chart, e.g. "fromPVToGrid".
+type PieChartArrow struct {
+	Direction string `json:"direction"`
+	Value     Watt   `json:"value"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type ForecastEntry struct {
 	Timestamp int64 `json:"timestamp"`
-	Expected  int   `json:"expected"`
-	Min       int   `json:"min"`
-	Max       int   `json:"max"`
+	Expected  Watt  `json:"expected"`
+	Min       Watt  `json:"min"`
+	Max       Watt  `json:"max"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type GetGatewayForecastResponse []ForecastEntry
@@ -191,6 +234,8 @@ type GetLowRateTariffResponse struct {
 	SatudayTo        string `json:"Satuday_to"`
 	SundayFrom       string `json:"Sunday_from"`
 	SundayTo         string `json:"Sunday_to"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unmodelled members, preserved when marshalling
 }
 
 type HeatPumpOperationState int
@@ -215,7 +260,46 @@ const (
 	Year  = "year"
 )
 
+// API is the set of SolarManager API calls implemented by Client, with and
+// without a context. Code using the API can depend on this interface and be
+// tested with the fake in package solarmanagertest. Methods may be added to
+// API as the client grows.
+type API interface {
+	GetGatewayInfo(solarManagerID string) (GetGatewayInfoResponse, error)
+	GetSensors(solarManagerID string) (GetSensorsResponse, error)
+	GetSensor(sensorID string) (GetSensorResponse, error)
+	GetGatewayData(solarManagerID string) (GetGatewayDataResponse, error)
+	GetSensorConsumptionStatistics(sensorID string, period StatisticPeriod) (GetSensorConsumptionStatisticsResponse, error)
+	GetGatewayConsumptionStatistics(solarManagerID string, period StatisticPeriod) (GetGatewayConsumptionStatisticsResponse, error)
+	GetSensorData(solarManagerID string, sensorID string) (GetSensorDataResponse, error)
+	GetGatewayPieChart(solarManagerID string) (GetGatewayPieChartResponse, error)
+	GetGatewayForecast(solarManagerID string) (GetGatewayForecastResponse, error)
+	GetLowRateTariff(solarManagerID string) (GetLowRateTariffResponse, error)
+
+	GetGatewayInfoContext(ctx context.Context, solarManagerID string) (GetGatewayInfoResponse, error)
+	GetSensorsContext(ctx context.Context, solarManagerID string) (GetSensorsResponse, error)
+	GetSensorContext(ctx context.Context, sensorID string) (GetSensorResponse, error)
+	GetGatewayDataContext(ctx context.Context, solarManagerID string) (GetGatewayDataResponse, error)
+	GetSensorConsumptionStatisticsContext(ctx context.Context, sensorID string, period StatisticPeriod) (GetSensorConsumptionStatisticsResponse, error)
+	GetGatewayConsumptionStatisticsContext(ctx context.Context, solarManagerID string, period StatisticPeriod) (GetGatewayConsumptionStatisticsResponse, error)
+	GetSensorDataContext(ctx context.Context, solarManagerID string, sensorID string) (GetSensorDataResponse, error)
+	GetGatewayPieChartContext(ctx context.Context, solarManagerID string) (GetGatewayPieChartResponse, error)
+	GetGatewayForecastContext(ctx context.Context, solarManagerID string) (GetGatewayForecastResponse, error)
+	GetLowRateTariffContext(ctx context.Context, solarManagerID string) (GetLowRateTariffResponse, error)
+	GetAllSensorData(ctx context.Context, solarManagerID string, concurrency int) (map[string]GetSensorDataResponse, error)
+
+	ListUsers(ctx context.Context, opts *ListOptions) *Iterator[User]
+	ListGateways(ctx context.Context, opts *ListOptions) *Iterator[GatewayInfo]
+}
+
+var _ API = (*Client)(nil)
+
 func (c *Client) GetGatewayInfo(solarManagerID string) (GetGatewayInfoResponse, error) {
+	return c.GetGatewayInfoContext(context.Background(), solarManagerID)
+}
+
+// GetGatewayInfoContext is like GetGatewayInfo with a context.
+func (c *Client) GetGatewayInfoContext(ctx context.Context, solarManagerID string) (GetGatewayInfoResponse, error) {
 	u := fmt.Sprintf("v1/info/gateway/%s", url.PathEscape(solarManagerID))
 
 	var response GetGatewayInfoResponse
@@ -223,11 +307,16 @@ func (c *Client) GetGatewayInfo(solarManagerID string) (GetGatewayInfoResponse,
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetGatewayInfo", Params: GatewayParams{SmID: solarManagerID}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetSensors(solarManagerID string) (GetSensorsResponse, error) {
+	return c.GetSensorsContext(context.Background(), solarManagerID)
+}
+
+// GetSensorsContext is like GetSensors with a context.
+func (c *Client) GetSensorsContext(ctx context.Context, solarManagerID string) (GetSensorsResponse, error) {
 	u := fmt.Sprintf("v1/info/sensors/%s", url.PathEscape(solarManagerID))
 
 	var response GetSensorsResponse
@@ -235,11 +324,16 @@ func (c *Client) GetSensors(solarManagerID string) (GetSensorsResponse, error) {
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetSensors", Params: GatewayParams{SmID: solarManagerID}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetSensor(sensorID string) (GetSensorResponse, error) {
+	return c.GetSensorContext(context.Background(), sensorID)
+}
+
+// GetSensorContext is like GetSensor with a context.
+func (c *Client) GetSensorContext(ctx context.Context, sensorID string) (GetSensorResponse, error) {
 	u := fmt.Sprintf("v1/info/sensor/%s", url.PathEscape(sensorID))
 
 	var response GetSensorResponse
@@ -247,23 +341,33 @@ func (c *Client) GetSensor(sensorID string) (GetSensorResponse, error) {
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetSensor", Params: SensorParams{SensorID: sensorID}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetGatewayData(solarManagerID string) (GetGatewayDataResponse, error) {
-	u := fmt.Sprintf("v1/info/stream/gateway/%s", url.PathEscape(solarManagerID))
+	return c.GetGatewayDataContext(context.Background(), solarManagerID)
+}
+
+// GetGatewayDataContext is like GetGatewayData with a context.
+func (c *Client) GetGatewayDataContext(ctx context.Context, solarManagerID string) (GetGatewayDataResponse, error) {
+	u := fmt.Sprintf("v1/stream/gateway/%s", url.PathEscape(solarManagerID))
 
 	var response GetGatewayDataResponse
 	req, err := c.NewRequest("GET", u, nil)
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetGatewayData", Params: GatewayParams{SmID: solarManagerID}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetSensorConsumptionStatistics(sensorID string, period StatisticPeriod) (GetSensorConsumptionStatisticsResponse, error) {
+	return c.GetSensorConsumptionStatisticsContext(context.Background(), sensorID, period)
+}
+
+// GetSensorConsumptionStatisticsContext is like GetSensorConsumptionStatistics with a context.
+func (c *Client) GetSensorConsumptionStatisticsContext(ctx context.Context, sensorID string, period StatisticPeriod) (GetSensorConsumptionStatisticsResponse, error) {
 	u := fmt.Sprintf("v1/consumption/sensor/%s?period=%s",
 		url.PathEscape(sensorID),
 		url.QueryEscape(string(period)))
@@ -273,11 +377,16 @@ func (c *Client) GetSensorConsumptionStatistics(sensorID string, period Statisti
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetSensorConsumptionStatistics", Params: StatisticsParams{SensorID: sensorID, Period: period}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetGatewayConsumptionStatistics(solarManagerID string, period StatisticPeriod) (GetGatewayConsumptionStatisticsResponse, error) {
+	return c.GetGatewayConsumptionStatisticsContext(context.Background(), solarManagerID, period)
+}
+
+// GetGatewayConsumptionStatisticsContext is like GetGatewayConsumptionStatistics with a context.
+func (c *Client) GetGatewayConsumptionStatisticsContext(ctx context.Context, solarManagerID string, period StatisticPeriod) (GetGatewayConsumptionStatisticsResponse, error) {
 	u := fmt.Sprintf("v1/consumption/gateway/%s?period=%s",
 		url.PathEscape(solarManagerID),
 		url.QueryEscape(string(period)))
@@ -287,11 +396,16 @@ func (c *Client) GetGatewayConsumptionStatistics(solarManagerID string, period S
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetGatewayConsumptionStatistics", Params: StatisticsParams{SmID: solarManagerID, Period: period}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetSensorData(solarManagerID string, sensorID string) (GetSensorDataResponse, error) {
+	return c.GetSensorDataContext(context.Background(), solarManagerID, sensorID)
+}
+
+// GetSensorDataContext is like GetSensorData with a context.
+func (c *Client) GetSensorDataContext(ctx context.Context, solarManagerID string, sensorID string) (GetSensorDataResponse, error) {
 	u := fmt.Sprintf("v1/stream/sensor/%s/%s", url.PathEscape(solarManagerID), url.PathEscape(sensorID))
 
 	var response GetSensorDataResponse
@@ -299,11 +413,16 @@ func (c *Client) GetSensorData(solarManagerID string, sensorID string) (GetSenso
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetSensorData", Params: SensorParams{SmID: solarManagerID, SensorID: sensorID}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetGatewayPieChart(solarManagerID string) (GetGatewayPieChartResponse, error) {
+	return c.GetGatewayPieChartContext(context.Background(), solarManagerID)
+}
+
+// GetGatewayPieChartContext is like GetGatewayPieChart with a context.
+func (c *Client) GetGatewayPieChartContext(ctx context.Context, solarManagerID string) (GetGatewayPieChartResponse, error) {
 	u := fmt.Sprintf("v1/chart/gateway/%s", url.PathEscape(solarManagerID))
 
 	var response GetGatewayPieChartResponse
@@ -311,11 +430,16 @@ func (c *Client) GetGatewayPieChart(solarManagerID string) (GetGatewayPieChartRe
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetGatewayPieChart", Params: GatewayParams{SmID: solarManagerID}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetGatewayForecast(solarManagerID string) (GetGatewayForecastResponse, error) {
+	return c.GetGatewayForecastContext(context.Background(), solarManagerID)
+}
+
+// GetGatewayForecastContext is like GetGatewayForecast with a context.
+func (c *Client) GetGatewayForecastContext(ctx context.Context, solarManagerID string) (GetGatewayForecastResponse, error) {
 	u := fmt.Sprintf("v1/forecast/gateways/%s", url.PathEscape(solarManagerID))
 
 	var response GetGatewayForecastResponse
@@ -323,11 +447,16 @@ func (c *Client) GetGatewayForecast(solarManagerID string) (GetGatewayForecastRe
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetGatewayForecast", Params: GatewayParams{SmID: solarManagerID}}, req, &response)
 	return response, err
 }
 
 func (c *Client) GetLowRateTariff(solarManagerID string) (GetLowRateTariffResponse, error) {
+	return c.GetLowRateTariffContext(context.Background(), solarManagerID)
+}
+
+// GetLowRateTariffContext is like GetLowRateTariff with a context.
+func (c *Client) GetLowRateTariffContext(ctx context.Context, solarManagerID string) (GetLowRateTariffResponse, error) {
 	u := fmt.Sprintf("v1/low-rate-tariff/gateways/%s", url.PathEscape(solarManagerID))
 
 	var response GetLowRateTariffResponse
@@ -335,6 +464,6 @@ func (c *Client) GetLowRateTariff(solarManagerID string) (GetLowRateTariffRespon
 	if err != nil {
 		return response, err
 	}
-	_, err = c.do(req, &response)
+	_, err = c.do(ctx, Operation{Name: "GetLowRateTariff", Params: GatewayParams{SmID: solarManagerID}}, req, &response)
 	return response, err
 }
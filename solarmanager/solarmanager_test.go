@@ -1,379 +1,552 @@
 package solarmanager
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
+// fixtures maps API path prefixes to the golden files in testdata.
+var fixtures = map[string]string{
+	"/v1/info/gateway/":             "gateway_info.json",
+	"/v1/info/sensors/":             "sensors.json",
+	"/v1/info/sensor/":              "sensor.json",
+	"/v1/stream/gateway/":           "gateway_data.json",
+	"/v1/consumption/sensor/":       "sensor_consumption.json",
+	"/v1/consumption/gateway/":      "gateway_consumption.json",
+	"/v1/stream/sensor/":            "sensor_data.json",
+	"/v1/chart/gateway/":            "gateway_pie_chart.json",
+	"/v1/forecast/gateways/":        "gateway_forecast.json",
+	"/v1/low-rate-tariff/gateways/": "low_rate_tariff.json",
+}
+
 // newTestServer returns a *httptest.Server serving mock responses for the SolarManager API.
-func newTestServer() *httptest.Server {
+// If requests is not nil, every received request is sent to it.
+func newTestServer(requests chan<- *http.Request) *httptest.Server {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/v1/info/gateway/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-  "gateway": {
-	"_id": "5c8fb8e7cdcda169da9d5fe3",
-	"signal": "connected",
-	"name": "1234123412341234",
-	"sm_id": "1234123412341234",
-	"owner": "5c8fb8fccdcda169da000000",
-	"firmware": "0.20.1",
-	"lastErrorDate": "2021-01-20T06:00:01.150Z",
-	"mac": "2C:3E:51:00:00:00",
-	"ip": "192.168.1.51"
-  },
-  "settings": {
-	"offset_watt": 50,
-	"low_m_f_from": "20:00",
-	"low_m_f_to": "07:00",
-	"low_sat_from": "00:00",
-	"low_sat_to": "07:00",
-	"low_sun_from": "00:00",
-	"low_sun_to": "07:00",
-	"houseFuse": 32,
-	"kWp": 24.489999771118164,
-	"loadManagement": true,
-	"commonSeasons": {
-	  "sunday": [
-		{
-		  "from": "00:00",
-		  "tariff": "low"
-		}
-	  ],
-	  "mondayFriday": [
-		{
-		  "from": "00:00",
-		  "tariff": "low"
-		},
-		{
-		  "tariff": "high",
-		  "from": "07:00"
-		},
-		{
-		  "from": "20:00",
-		  "tariff": "low"
-		}
-	  ],
-	  "saturday": [
-		{
-		  "tariff": "low",
-		  "from": "00:00"
-		}
-	  ]
-	},
-	"highTariff": 0.24,
-	"isWinterTimeEnabled": false,
-	"lowTariff": 0.19,
-	"provider": null,
-	"tariffType": "double",
-	"winterSeason": {
-	  "sunday": [
-		{
-		  "tariff": "low",
-		  "from": "00:00"
-		}
-	  ],
-	  "mondayFriday": [
-		{
-		  "from": "00:00",
-		  "tariff": "low"
-		},
-		{
-		  "from": "07:00",
-		  "tariff": "high"
-		},
-		{
-		  "from": "20:00",
-		  "tariff": "low"
-		}
-	  ],
-	  "saturday": [
-		{
-		  "tariff": "low",
-		  "from": "00:00"
-		},
-		{
-		  "from": "07:00",
-		  "tariff": "high"
-		}
-	  ]
+	for prefix, fixture := range fixtures {
+		fixture := fixture
+		mux.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+			if requests != nil {
+				requests <- r
+			}
+			http.ServeFile(w, r, filepath.Join("testdata", fixture))
+		})
 	}
-  }
+	return httptest.NewServer(mux)
 }
-`))
-	})
-	mux.HandleFunc("/v1/info/sensors/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-[
-	{
-		"_id": "5da07dc5d32a997fd7fb80aa",
-		"priority": 7,
-		"device_type": "device",
-		"signal": "connected",
-		"type": "Water Heater",
-		"device_group": "myPV AC THOR",
-		"ip": "78.45.12.130",
-		"tag": null,
-		"createdAt": "2019-10-16T11:23:43.229Z",
-		"updatedAt": "2020-10-20T11:31:14.842Z"
-	},
-	{
-		"_id": "5da6fdbf6f9aab5013a5cb9f",
-		"priority": 5,
-		"device_type": "device",
-		"signal": "connected",
-		"device_group": "KEBA Wallbox P30",
-		"type": "Car Charging",
-		"createdAt": "2019-10-16T11:23:43.229Z",
-		"updatedAt": "2020-10-20T11:31:14.842Z",
-		"tag": {
-			"_id": "5dfb86da1cdd557b82303f92",
-			"name": "Tag_1"
-		},
-		"ip": "1.5.5.10"
+
+func newTestClient(t *testing.T, svr *httptest.Server) *Client {
+	t.Helper()
+	baseURL, err := url.Parse(svr.URL)
+	if err != nil {
+		t.Fatal(err)
 	}
-]`))
-	})
-	mux.HandleFunc("/v1/info/sensor/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-	"_id": "5da07dc5d32a997fd7fb80aa",
-	"priority": 7,
-	"device_type": "device",
-	"signal": "connected",
-	"type": "Water Heater",
-	"device_group": "myPV AC THOR",
-	"ip": "78.45.12.130",
-	"createdAt": "2019-10-11T13:04:05.719Z",
-	"updatedAt": "2020-02-20T11:46:12.358Z",
-	"tag": null
-}`))
-	})
-	mux.HandleFunc("/v1/stream/gateway/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-	"Interface Version": "1.0",
-	"TimeStamp": "2021-02-01T16:09:39.744Z",
-	"currentBatteryChargeDischarge": 0,
-	"currentPowerConsumption": 494,
-	"currentPvGeneration": 0,
-	"devices": [
+	return NewClient(nil, baseURL, "username", "password")
+}
+
+func TestGetGatewayInfo(t *testing.T) {
+	svr := newTestServer(nil)
+	defer svr.Close()
+	client := newTestClient(t, svr)
+	resp, err := client.GetGatewayInfo("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Gateway.Owner != "5c8fb8fccdcda169da000000" {
+		t.Fatalf("unexpected owner, expected 5c8fb8fccdcda169da000000, but got %s", resp.Gateway.Owner)
+	}
+}
+
+func TestGetSensors(t *testing.T) {
+	svr := newTestServer(nil)
+	defer svr.Close()
+	client := newTestClient(t, svr)
+	resp, err := client.GetSensors("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp) != 2 {
+		t.Fatalf("unexpected number of sensors, expected 2, but got %d", len(resp))
+	}
+
+	if resp[0].DeviceGroup != "myPV AC THOR" {
+		t.Fatalf("unexpected device group for sensor 0, expected %q, but got %s", "myPV AC THOR", resp[0].DeviceGroup)
+	}
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestEndpoints(t *testing.T) {
+	// IDs containing reserved characters verify that path segments and
+	// query parameters are escaped.
+	const smID = "sm/1 2"
+	const sensorID = "sensor?1"
+	const period = StatisticPeriod("day&x=1")
+
+	tests := []struct {
+		name      string
+		call      func(c *Client) (interface{}, error)
+		path      string
+		query     string
+		checkBody func(t *testing.T, v interface{})
+	}{
 		{
-			"_id": "5e07c29ecb03704972e486cc",
-			"accumulatedErrorCount": 0,
-			"currentPowerInvSm": 0,
-			“currentEnergy”: 0
-			"errors": [],
-			"signal": "connected"
+			name: "GetGatewayInfo",
+			call: func(c *Client) (interface{}, error) { return c.GetGatewayInfo(smID) },
+			path: "/v1/info/gateway/sm%2F1%202",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetGatewayInfoResponse)
+				if resp.Gateway.Firmware != "0.20.1" || !resp.Gateway.IsInstallationCompleted {
+					t.Errorf("unexpected gateway %+v", resp.Gateway)
+				}
+				if !resp.Gateway.LastErrorDate.Equal(mustTime(t, "2021-01-20T06:00:01.150Z")) {
+					t.Errorf("unexpected last error date %v", resp.Gateway.LastErrorDate)
+				}
+				if resp.Settings.HouseFuse != 32 || resp.Settings.LowTariff != 0.19 || len(resp.Settings.WinterSeason.Saturday) != 2 {
+					t.Errorf("unexpected settings %+v", resp.Settings)
+				}
+				if resp.User.City != "Zürich" {
+					t.Errorf("unexpected user %+v", resp.User)
+				}
+			},
 		},
 		{
-			"_id": "5e08ab9ccb03704972029a2c",
-			"accumulatedErrorCount": 6,
-			"currentPowerInvSm": 0,
-			"errors": [],
-			"signal": "connected"
+			name: "GetSensors",
+			call: func(c *Client) (interface{}, error) { return c.GetSensors(smID) },
+			path: "/v1/info/sensors/sm%2F1%202",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetSensorsResponse)
+				if len(resp) != 2 || resp[1].Tag.Name != "Tag_1" || resp[1].Priority != 5 {
+					t.Errorf("unexpected sensors %+v", resp)
+				}
+			},
 		},
 		{
-			"_id": "5e0cd6f6dde8943e7179ebda",
-			"accumulatedErrorCount": 0,
-			"activeDevice": 0,
-			"currentPower": 0,
-			"errors": [],
-			"signal": "connected",
-			"switchState": 1
+			name: "GetSensor",
+			call: func(c *Client) (interface{}, error) { return c.GetSensor(sensorID) },
+			path: "/v1/info/sensor/sensor%3F1",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetSensorResponse)
+				if resp.Type != "Water Heater" || !resp.UpdatedAt.Equal(mustTime(t, "2020-02-20T11:46:12.358Z")) {
+					t.Errorf("unexpected sensor %+v", resp)
+				}
+			},
 		},
 		{
-			"_id": "5f7d950deb88166c81c56f7a",
-			"accumulatedErrorCount": 34,
-			"activeDevice": 0,
-			"currentPower": 0,
-			"currentWaterTemp": 44,
-			"errors": [],
-			"signal": "connected",
-			"status": 0
+			name: "GetGatewayData",
+			call: func(c *Client) (interface{}, error) { return c.GetGatewayData(smID) },
+			path: "/v1/stream/gateway/sm%2F1%202",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetGatewayDataResponse)
+				if resp.InterfaceVersion != "1.0" || resp.CurrentPowerConsumption != 494 || len(resp.Devices) != 7 {
+					t.Errorf("unexpected gateway data %+v", resp)
+				}
+				if d := resp.Devices[3]; d.CurrentWaterTemp != Some(44) || d.AccumulatedErrorCount != 34 {
+					t.Errorf("unexpected device %+v", d)
+				}
+				if d := resp.Devices[5]; d.Signal != "not connected" || !reflect.DeepEqual(d.Errors, []int{1}) {
+					t.Errorf("unexpected device %+v", d)
+				}
+			},
 		},
 		{
-			"SOC": 0,
-			"_id": "5d604d02b364481c2e0c72b5",
-			"accumulatedErrorCount": 0,
-			"activeDevice": 0,
-			"currentPower": 0,
-			"errors": [],
-			"signal": "connected"
+			name:  "GetSensorConsumptionStatistics",
+			call:  func(c *Client) (interface{}, error) { return c.GetSensorConsumptionStatistics(sensorID, period) },
+			path:  "/v1/consumption/sensor/sensor%3F1",
+			query: "period=day%26x%3D1",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetSensorConsumptionStatisticsResponse)
+				if len(resp.Data) != 1 || resp.Data[0].Consumption != 120.83333429999996 || resp.TotalConsumption != 120.83333429999996 {
+					t.Errorf("unexpected statistics %+v", resp)
+				}
+			},
 		},
 		{
-			"_id": "5ef0fe7cb9c6c4306c885133",
-			"accumulatedErrorCount": 2067,
-			"activeDevice": 0,
-			"currentPower": 0,
-			"errors": [
-				1
-			],
-			"signal": "not connected",
-			"switchState": 0
+			name:  "GetGatewayConsumptionStatistics",
+			call:  func(c *Client) (interface{}, error) { return c.GetGatewayConsumptionStatistics(smID, period) },
+			path:  "/v1/consumption/gateway/sm%2F1%202",
+			query: "period=day%26x%3D1",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetGatewayConsumptionStatisticsResponse)
+				if resp.GatewayId != "5c8fb8e7cdcda169da9d5fe3" || len(resp.Data) != 1 || resp.Data[0].CreatedAt != "2021-04-13" {
+					t.Errorf("unexpected statistics %+v", resp)
+				}
+			},
 		},
 		{
-			"_id": "5d875f92f41d1c0df7b2ca7f",
-			"accumulatedErrorCount": 2067,
-			"activeDevice": 0,
-			"currentPower": 0,
-			"currentWaterTemp": 0,
-			"errors": [
-				5
-			],
-			"signal": "not connected"
-		}
-	],
-	"errors": [],
-	"soc": 0
-}`))
-	})
-	mux.HandleFunc("/v1/consumption/sensor/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-	"sensorId": "5da6fdbf6f9aab5013a5cb9f",
-	"period": "day",
-	"data": [
-		{
-			"createdAt": "2021-01-01",
-			"consumption": 120.83333429999996
-		}
-	],
-	"totalConsumption": 120.83333429999996
-}`))
-	})
-	mux.HandleFunc("/v1/consumption/gateway/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-	"gatewayId": "5c8fb8e7cdcda169da9d5fe3",
-	"period": "day",
-	"data": [
-		{
-			"createdAt": "2021-04-13",
-			"consumption": 0,
-			"production": 0
-		}
-	],
-	"totalConsumption": 0
-}`))
-	})
-	mux.HandleFunc("/v1/stream/sensor/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-	"date": "2021-03-25T09:26:37.037Z",
-	"data": {
-		"_id": "5db9b0bc2b591c467a947428",
-		"signal": "connected",
-		"currentPower": 1,
-		"currentWaterTemp": 26,
-		"errors": [
-			1,
-			15,
-			10
-		]
-	}
-}`))
-	})
-	mux.HandleFunc("/v1/chart/gateway/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-	"lastUpdate": "2021-04-07T15:24:55.608Z",
-	"production": 20000,
-	"consumption": 5000,
-	"battery": {
-		"capacity": 43,
-		"batteryCharging": 0,
-		"batteryDischarging": 0
-	},
-	"arrows": [
+			name: "GetSensorData",
+			call: func(c *Client) (interface{}, error) { return c.GetSensorData(smID, sensorID) },
+			path: "/v1/stream/sensor/sm%2F1%202/sensor%3F1",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetSensorDataResponse)
+				if resp.Data.CurrentWaterTemp != Some(26) || !reflect.DeepEqual(resp.Data.Errors, []int{1, 15, 10}) {
+					t.Errorf("unexpected sensor data %+v", resp)
+				}
+			},
+		},
 		{
-			"direction": "fromPVToGrid",
-			"value": 15000 // {number} - power in W
+			name: "GetGatewayPieChart",
+			call: func(c *Client) (interface{}, error) { return c.GetGatewayPieChart(smID) },
+			path: "/v1/chart/gateway/sm%2F1%202",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetGatewayPieChartResponse)
+				if resp.Production != 20000 || resp.Battery.Capacity != 43 || len(resp.Arrows) != 3 {
+					t.Errorf("unexpected pie chart %+v", resp)
+				}
+				if a := resp.Arrows[0]; a.Direction != "fromPVToGrid" || a.Value != 15000 {
+					t.Errorf("unexpected arrow %+v", a)
+				}
+			},
 		},
 		{
-			"direction": "fromGridToConsumer",
-			"value": 0 // {number} - power in W
+			name: "GetGatewayForecast",
+			call: func(c *Client) (interface{}, error) { return c.GetGatewayForecast(smID) },
+			path: "/v1/forecast/gateways/sm%2F1%202",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetGatewayForecastResponse)
+				expected := ForecastEntry{Timestamp: 1641809700000, Expected: 1638, Min: 1120, Max: 2155}
+				if len(resp) != 2 || !reflect.DeepEqual(resp[1], expected) {
+					t.Errorf("unexpected forecast %+v", resp)
+				}
+			},
 		},
 		{
-			"direction": "fromPVToConsumer",
-			"value": 5000 // {number} - power in W
+			name: "GetLowRateTariff",
+			call: func(c *Client) (interface{}, error) { return c.GetLowRateTariff(smID) },
+			path: "/v1/low-rate-tariff/gateways/sm%2F1%202",
+			checkBody: func(t *testing.T, v interface{}) {
+				resp := v.(GetLowRateTariffResponse)
+				if resp.SatudayFrom != "13:00" || resp.SundayTo != "07:00" {
+					t.Errorf("unexpected tariff %+v", resp)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan *http.Request, 1)
+			svr := newTestServer(requests)
+			defer svr.Close()
+			client := newTestClient(t, svr)
+
+			v, err := tt.call(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if r.Method != "GET" {
+				t.Errorf("unexpected method %s", r.Method)
+			}
+			if r.URL.EscapedPath() != tt.path {
+				t.Errorf("unexpected path, expected %s, but got %s", tt.path, r.URL.EscapedPath())
+			}
+			if r.URL.RawQuery != tt.query {
+				t.Errorf("unexpected query, expected %q, but got %q", tt.query, r.URL.RawQuery)
+			}
+			if u, p, ok := r.BasicAuth(); !ok || u != "username" || p != "password" {
+				t.Errorf("unexpected basic auth %q:%q", u, p)
+			}
+			if r.Header.Get("Accept") != "application/json" || r.Header.Get("User-Agent") != userAgent {
+				t.Errorf("unexpected headers %v", r.Header)
+			}
+			tt.checkBody(t, v)
+		})
+	}
+}
+
+// TestFixtures verifies that the golden files are valid JSON and contain no
+// fields missing from the response types.
+func TestFixtures(t *testing.T) {
+	types := map[string]interface{}{
+		"gateway_info.json":        &GetGatewayInfoResponse{},
+		"sensors.json":             &GetSensorsResponse{},
+		"sensor.json":              &GetSensorResponse{},
+		"gateway_data.json":        &GetGatewayDataResponse{},
+		"sensor_consumption.json":  &GetSensorConsumptionStatisticsResponse{},
+		"gateway_consumption.json": &GetGatewayConsumptionStatisticsResponse{},
+		"sensor_data.json":         &GetSensorDataResponse{},
+		"gateway_pie_chart.json":   &GetGatewayPieChartResponse{},
+		"gateway_forecast.json":    &GetGatewayForecastResponse{},
+		"low_rate_tariff.json":     &GetLowRateTariffResponse{},
+	}
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
 		}
-	]
-}`))
-	})
-	mux.HandleFunc("/v1/forecast/gateways/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-[
-	{
-		"timestamp": 1641808800000,
-		"expected": 1726,
-		"min": 1183,
-		"max": 2269
-	},
-	{
-		"timestamp": 1641809700000,
-		"expected": 1638,
-		"min": 1120,
-		"max": 2155
-	},
-]`))
-	})
-	mux.HandleFunc("/v1/low-rate-tariff/gateways/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-{
-	"Monday_Friday_from": "20:00",
-	"Monday_Friday_to": "07:00",
-	"Satuday_from": "13:00",
-	"Satuday_to": "07:00",
-	"Sunday_from": "00:00",
-	"Sunday_to": "07:00"
-}`))
-	})
-	return httptest.NewServer(mux)
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(types[fixture]); err != nil {
+			t.Errorf("%s: %v", fixture, err)
+		}
+	}
 }
 
-func newTestClient(t *testing.T, svr *httptest.Server) *Client {
-	t.Helper()
-	baseURL, err := url.Parse(svr.URL)
+func TestSchemaWarnings(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+	{"_id": "a", "priority": "7", "signal": "connected", "inverterTemp": 41.5},
+	{"_id": "b", "priority": 5, "tag": {"_id": "t", "name": "Tag_1", "color": "red"}}
+]`))
+	}))
+	defer svr.Close()
+	client := newTestClient(t, svr)
+
+	var typeErr *json.UnmarshalTypeError
+	if _, err := client.GetSensors("sm1"); !errors.As(err, &typeErr) || typeErr.Field != "[0].priority" {
+		t.Fatalf("expected type mismatch error without strict decoding, got %v", err)
+	}
+
+	var warnings []string
+	client.SchemaWarningHandler = func(w SchemaWarning) {
+		warnings = append(warnings, fmt.Sprintf("%s %s %s %s", w.Kind, w.Path, w.Value, w.GoType))
+	}
+	var raw []byte
+	client.RawResponseHandler = func(req *http.Request, body []byte) {
+		raw = body
+	}
+	sensors, err := client.GetSensors("sm1")
 	if err != nil {
 		t.Fatal(err)
 	}
-	return NewClient(nil, baseURL, "username", "password")
+	if len(sensors) != 2 || sensors[0].Signal != "connected" || sensors[1].Tag.Name != "Tag_1" {
+		t.Fatalf("unexpected sensors %+v", sensors)
+	}
+	sort.Strings(warnings)
+	expected := []string{
+		"type mismatch [0].priority \"7\" int",
+		"unknown field [0].inverterTemp 41.5 ",
+		"unknown field [1].tag.color \"red\" ",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("unexpected warnings, expected %q, but got %q", expected, warnings)
+	}
+	if !bytes.Contains(raw, []byte("inverterTemp")) {
+		t.Fatalf("raw response not captured: %s", raw)
+	}
+
+	var callRaw []byte
+	if _, err := client.GetSensorsContext(WithRawResponse(context.Background(), &callRaw), "sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(callRaw, raw) {
+		t.Fatalf("raw response of call not captured: %s", callRaw)
+	}
 }
 
-func TestGetGatewayInfo(t *testing.T) {
-	svr := newTestServer()
-	defer svr.Close()
-	client := newTestClient(t, svr)
-	resp, err := client.GetGatewayInfo("")
+func TestExtraFields(t *testing.T) {
+	in := `{"Interface Version":"1.0","TimeStamp":"2021-02-01T16:09:39.744Z","currentBatteryChargeDischarge":0,"currentPowerConsumption":494,"currentPvGeneration":0,` +
+		`"devices":[{"_id":"a","accumulatedErrorCount":0,"errors":[],"signal":"connected","currentPower":5,"inverterTemp":41.5,"phases":[1,2,3]}],` +
+		`"errors":[],"soc":0,"gridFrequency":50.01}`
+
+	var d GetGatewayDataResponse
+	if err := json.Unmarshal([]byte(in), &d); err != nil {
+		t.Fatal(err)
+	}
+	if string(d.Extra["gridFrequency"]) != "50.01" {
+		t.Fatalf("unexpected gateway extra %v", d.Extra)
+	}
+	dev := d.Devices[0]
+	if dev.CurrentPower != Some[Watt](5) || len(dev.Extra) != 2 || string(dev.Extra["phases"]) != "[1,2,3]" {
+		t.Fatalf("unexpected device %+v", dev)
+	}
+
+	out, err := json.Marshal(d)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if string(out) != in {
+		t.Fatalf("extra fields not preserved, expected\n%s\nbut got\n%s", in, out)
+	}
 
-	if resp.Gateway.Owner != "5c8fb8fccdcda169da000000" {
-		t.Fatalf("unexpected owner, expected 5c8fb8fccdcda169da000000, but got %s", resp.Gateway.Owner)
+	var info GetGatewayInfoResponse
+	if err := json.Unmarshal([]byte(`{"gateway": {"sm_id": "x", "hwVersion": "2"}, "installer": {"name": "ACME"}}`), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Gateway.SmId != "x" || string(info.Gateway.Extra["hwVersion"]) != `"2"` || string(info.Extra["installer"]) != `{"name": "ACME"}` {
+		t.Fatalf("unexpected gateway info %+v", info)
+	}
+
+	nested := `{"gateway":{"sm_id":"x"},"settings":{"kWp":9.5,"commonSeasons":{"sunday":[{"from":"00:00","tariff":"low","days":[0]}],"holidays":[]},"currency":"CHF"},"versions":{"supportContract":true,"app":"1.2"}}`
+	if err := json.Unmarshal([]byte(nested), &info); err != nil {
+		t.Fatal(err)
+	}
+	if string(info.Settings.Extra["currency"]) != `"CHF"` || string(info.Versions.Extra["app"]) != `"1.2"` ||
+		string(info.Settings.CommonSeasons.Extra["holidays"]) != "[]" || string(info.Settings.CommonSeasons.Sunday[0].Extra["days"]) != "[0]" {
+		t.Fatalf("unexpected nested extra %+v", info)
+	}
+	if out, err := json.Marshal(info.Versions); err != nil || string(out) != `{"supportContract":true,"app":"1.2"}` {
+		t.Fatalf("unexpected versions %s, %v", out, err)
+	}
+
+	for _, tc := range []struct {
+		in string
+		v  interface{}
+	}{
+		{`{"date":"2021-02-01T16:09:39.744Z","data":{"_id":"a","accumulatedErrorCount":0,"errors":[],"signal":"connected","phases":3},"unit":"W"}`, &GetSensorDataResponse{}},
+		{`{"sensorId":"a","period":"day","data":[{"createdAt":"2021-01-01","consumption":1,"unit":"Wh"}],"totalConsumption":1,"unit":"Wh"}`, &GetSensorConsumptionStatisticsResponse{}},
+		{`{"gatewayId":"x","period":"day","data":[{"createdAt":"2021-01-01","consumption":1,"production":2,"unit":"Wh"}],"totalConsumption":1,"unit":"Wh"}`, &GetGatewayConsumptionStatisticsResponse{}},
+		{`{"lastUpdate":"2021-02-01T16:09:39.744Z","production":1,"consumption":1,"battery":{"capacity":0,"batteryCharging":0,"batteryDischarging":0,"unit":"W"},"arrows":[{"direction":"fromPVToConsumer","value":1,"unit":"W"}]}`, &GetGatewayPieChartResponse{}},
+		{`{"timestamp":1,"expected":1,"min":1,"max":1,"unit":"W"}`, &ForecastEntry{}},
+		{`{"Monday_Friday_from":"","Monday_Friday_to":"","Satuday_from":"","Satuday_to":"","Sunday_from":"","Sunday_to":"","unit":"h"}`, &GetLowRateTariffResponse{}},
+	} {
+		if err := json.Unmarshal([]byte(tc.in), tc.v); err != nil {
+			t.Fatal(err)
+		}
+		out, err := json.Marshal(tc.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.in {
+			t.Fatalf("extra fields of %T not preserved, expected\n%s\nbut got\n%s", tc.v, tc.in, out)
+		}
+	}
+
+	var plain SensorData
+	if err := json.Unmarshal([]byte(`{"_id": "a", "SIGNAL": "connected"}`), &plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain.Signal != "connected" || plain.Extra != nil {
+		t.Fatalf("case-insensitive match treated as extra: %+v", plain)
 	}
 }
 
-func TestGetSensors(t *testing.T) {
-	svr := newTestServer()
-	defer svr.Close()
-	client := newTestClient(t, svr)
-	resp, err := client.GetSensors("")
+func TestOptional(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected Optional[Watt]
+	}{
+		{`{"_id":"a","accumulatedErrorCount":0,"errors":null,"signal":"","currentPower":0}`, Some[Watt](0)},
+		{`{"_id":"a","accumulatedErrorCount":0,"errors":null,"signal":"","currentPower":null}`, Null[Watt]()},
+		{`{"_id":"a","accumulatedErrorCount":0,"errors":null,"signal":""}`, Optional[Watt]{}},
+	}
+	for _, tt := range tests {
+		var d SensorData
+		if err := json.Unmarshal([]byte(tt.in), &d); err != nil {
+			t.Fatal(err)
+		}
+		if d.CurrentPower != tt.expected {
+			t.Fatalf("unexpected current power for %s, expected %+v, but got %+v", tt.in, tt.expected, d.CurrentPower)
+		}
+		out, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tt.in {
+			t.Fatalf("round trip failed, expected\n%s\nbut got\n%s", tt.in, out)
+		}
+	}
+
+	// A mismatched value leaves the field absent without dropping the
+	// members after it.
+	var d SensorData
+	if err := json.Unmarshal([]byte(`{"currentPower":"n/a","switchState":"1","signal":"connected"}`), &d); err != nil {
+		t.Fatal(err)
+	}
+	if !d.CurrentPower.IsZero() || !d.SwitchState.IsZero() || d.Signal != "connected" {
+		t.Fatalf("unexpected sensor data %+v", d)
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "gateway_info.json"))
 	if err != nil {
 		t.Fatal(err)
 	}
+	var info GetGatewayInfoResponse
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.Settings.Provider.Null {
+		t.Fatalf("expected null provider, got %+v", info.Settings.Provider)
+	}
+	out, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out, []byte(`"provider":null`)) {
+		t.Fatalf("null provider not preserved: %s", out)
+	}
+}
 
-	if len(resp) != 2 {
-		t.Fatalf("unexpected number of sensors, expected 2, but got %d", len(resp))
+func TestUnits(t *testing.T) {
+	var d struct {
+		A, B, C Watt
+		D       WattHour
+	}
+	d.C = 7
+	if err := json.Unmarshal([]byte(`{"A": 1200, "B": 1.5, "C": null, "D": " 120.83333429999996"}`), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.A != 1200 || d.B != 1.5 || d.C != 7 || d.D != 120.83333429999996 {
+		t.Fatalf("unexpected values %+v", d)
+	}
+	if d.A.Kilowatts() != 1.2 || d.D.KilowattHours() != 0.12083333429999996 {
+		t.Fatalf("unexpected conversion %v %v", d.A.Kilowatts(), d.D.KilowattHours())
+	}
+	for v, expected := range map[fmt.Stringer]string{
+		Watt(494):         "494 W",
+		Watt(-1500):       "-1.5 kW",
+		WattHour(120.833): "120.83 Wh",
+		WattHour(12345):   "12.35 kWh",
+	} {
+		if got := v.String(); got != expected {
+			t.Fatalf("unexpected string, expected %q, but got %q", expected, got)
+		}
 	}
 
-	if resp[0].DeviceGroup != "myPV AC THOR" {
-		t.Fatalf("unexpected device group for sensor 0, expected %q, but got %s", "myPV AC THOR", resp[0].DeviceGroup)
+	// Values that are not numbers are left unchanged like null, and
+	// reported by the schema check instead.
+	w := Watt(3)
+	for _, in := range []string{`"abc"`, `true`, `"NaN"`, `"-Inf"`} {
+		if err := json.Unmarshal([]byte(in), &w); err != nil || w != 3 {
+			t.Fatalf("unexpected result for %s: %v (%v)", in, w, err)
+		}
+	}
+	out, err := json.Marshal(struct{ P Watt }{1.5})
+	if err != nil || string(out) != `{"P":1.5}` {
+		t.Fatalf("unexpected encoding %s (%v)", out, err)
+	}
+
+	var warnings []string
+	checkSchema([]byte(`{"currentPower": "12.5", "currentEnergy": "abc", "currentPowerInvSm": "Infinity"}`), reflect.TypeOf(SensorData{}), func(kind SchemaWarningKind, path string, _ json.RawMessage, _ reflect.Type) {
+		warnings = append(warnings, kind.String()+" "+path)
+	})
+	sort.Strings(warnings)
+	if !reflect.DeepEqual(warnings, []string{"type mismatch currentEnergy", "type mismatch currentPowerInvSm"}) {
+		t.Fatalf("unexpected warnings %q", warnings)
 	}
 }
 
@@ -389,3 +562,518 @@ func ExampleClient_GetSensors() {
 	}
 	fmt.Println(sensors)
 }
+
+func TestErrorResponse(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "gateway not found"}`))
+	}))
+	defer svr.Close()
+	client := newTestClient(t, svr)
+	_, err := client.GetGatewayInfo("unknown")
+	errorResponse, ok := err.(*ErrorResponse)
+	if !ok {
+		t.Fatalf("unexpected error type %T", err)
+	}
+	if errorResponse.Response.StatusCode != http.StatusNotFound || errorResponse.Message != "gateway not found" {
+		t.Fatalf("unexpected error response %v", errorResponse)
+	}
+}
+
+func TestGetGatewayDataPath(t *testing.T) {
+	var path string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"Interface Version": "1.0", "currentPowerConsumption": 494, "devices": []}`))
+	}))
+	defer svr.Close()
+	client := newTestClient(t, svr)
+	data, err := client.GetGatewayData("sm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/stream/gateway/sm1" || data.CurrentPowerConsumption != 494 {
+		t.Fatalf("unexpected path %s or data %+v", path, data)
+	}
+}
+
+type countingLimiter struct{ n atomic.Int32 }
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.n.Add(1)
+	return ctx.Err()
+}
+
+func TestGetAllSensorData(t *testing.T) {
+	var active, maxActive atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/info/sensors/sm1" {
+			w.Write([]byte(`[{"_id": "s1"}, {"_id": "s2"}, {"_id": "s3"}, {"_id": "s4"}, {"_id": "s5"}, {"_id": "s6"}]`))
+			return
+		}
+		n := active.Add(1)
+		defer active.Add(-1)
+		for m := maxActive.Load(); n > m && !maxActive.CompareAndSwap(m, n); m = maxActive.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		sensorID := strings.TrimPrefix(r.URL.Path, "/v1/stream/sensor/sm1/")
+		if sensorID == "s4" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"_id": %q}}`, sensorID)
+	}))
+	defer svr.Close()
+	client := newTestClient(t, svr)
+	limiter := &countingLimiter{}
+	client.Limiter = limiter
+
+	results, err := client.GetAllSensorData(context.Background(), "sm1", 2)
+	if len(results) != 5 || results["s1"].Data.Id != "s1" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	var sensorErr *SensorError
+	if !errors.As(err, &sensorErr) || sensorErr.SensorID != "s4" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var errorResponse *ErrorResponse
+	if !errors.As(err, &errorResponse) || errorResponse.Response.StatusCode != http.StatusBadGateway {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := maxActive.Load(); n != 2 {
+		t.Fatalf("expected 2 concurrent requests, got %d", n)
+	}
+	if n := limiter.n.Load(); n != 7 {
+		t.Fatalf("expected limiter to be waited on 7 times, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetAllSensorData(ctx, "sm1", 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+}
+
+func TestIterator(t *testing.T) {
+	var pages []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.RawQuery)
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Write([]byte(`[{"sm_id": "a"}, {"sm_id": "b"}]`))
+		case "2":
+			w.Write([]byte(`[{"sm_id": "c"}, {"sm_id": "d"}]`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer svr.Close()
+	client := newTestClient(t, svr)
+
+	gateways, err := client.ListGateways(context.Background(), &ListOptions{PageSize: 2}).All()
+	if len(gateways) != 4 || gateways[3].SmId != "d" {
+		t.Fatalf("unexpected gateways %+v", gateways)
+	}
+	var errorResponse *ErrorResponse
+	if !errors.As(err, &errorResponse) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"page=1&limit=2", "page=2&limit=2", "page=3&limit=2"}
+	if !reflect.DeepEqual(pages, expected) {
+		t.Fatalf("unexpected pages %q", pages)
+	}
+}
+
+func TestIteratorEmptyPage(t *testing.T) {
+	// Full pages followed by an empty one.
+	var pages []int
+	users, err := NewIterator(context.Background(), &ListOptions{PageSize: 1}, func(ctx context.Context, page, pageSize int) ([]User, error) {
+		pages = append(pages, page)
+		if page > 2 {
+			return nil, nil
+		}
+		return []User{{UserId: fmt.Sprint(page)}}, nil
+	}).All()
+	if err != nil || len(users) != 2 || !reflect.DeepEqual(pages, []int{1, 2, 3}) {
+		t.Fatalf("unexpected users %+v, pages %v, error %v", users, pages, err)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	var mu sync.Mutex
+	var logins, refreshes int
+	valid := map[string]bool{}
+	issue := func(w http.ResponseWriter, n int) {
+		access := fmt.Sprintf("access-%d", n)
+		valid[access] = true
+		fmt.Fprintf(w, `{"accessToken": %q, "refreshToken": "refresh-%d", "expiresIn": 3600, "tokenType": "Bearer"}`, access, n)
+	}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/oauth/login":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["email"] != "max@example.com" || body["password"] != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logins++
+			issue(w, logins+refreshes)
+		case "/v1/oauth/refresh":
+			refreshes++
+			issue(w, logins+refreshes)
+		default:
+			if _, _, ok := r.BasicAuth(); ok || !valid[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer svr.Close()
+
+	now := time.Date(2021, 4, 7, 12, 0, 0, 0, time.UTC)
+	store := FileTokenStore{Path: filepath.Join(t.TempDir(), "token.json")}
+	client := newTestClient(t, svr)
+	auth := NewTokenAuth(client, "max@example.com", "secret")
+	auth.Store = store
+	auth.Now = func() time.Time { return now }
+	client.Authenticator = auth
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetSensors("sm1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if logins != 1 || refreshes != 0 {
+		t.Fatalf("expected a single login, got %d logins and %d refreshes", logins, refreshes)
+	}
+
+	// Tokens are refreshed before they expire.
+	now = now.Add(time.Hour)
+	if _, err := client.GetSensors("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	// Revoked tokens are refreshed after a 401 response.
+	mu.Lock()
+	clear(valid)
+	mu.Unlock()
+	if _, err := client.GetSensors("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 1 || refreshes != 2 {
+		t.Fatalf("expected 2 refreshes, got %d logins and %d refreshes", logins, refreshes)
+	}
+
+	// A new client picks up the persisted token.
+	client = newTestClient(t, svr)
+	auth = NewTokenAuth(client, "max@example.com", "wrong")
+	auth.Store = store
+	auth.Now = func() time.Time { return now }
+	client.Authenticator = auth
+	if _, err := client.GetSensors("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 1 || refreshes != 2 {
+		t.Fatalf("persisted token not used, got %d logins and %d refreshes", logins, refreshes)
+	}
+	if fi, err := os.Stat(store.Path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected token file %v (%v)", fi, err)
+	}
+
+	// Without a valid refresh token or password, the 401 is returned.
+	mu.Lock()
+	clear(valid)
+	mu.Unlock()
+	auth.mu.Lock()
+	auth.token.RefreshToken = ""
+	auth.mu.Unlock()
+	var errorResponse *ErrorResponse
+	if _, err := client.GetSensors("sm1"); !errors.As(err, &errorResponse) || errorResponse.Response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 error, got %v", err)
+	}
+}
+
+func TestTokenAuthWithoutExpiry(t *testing.T) {
+	var logins, refreshes atomic.Int32
+	var revoked atomic.Bool
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/oauth/login":
+			logins.Add(1)
+			w.Write([]byte(`{"accessToken": "access-1", "refreshToken": "refresh-1"}`))
+		case "/v1/oauth/refresh":
+			refreshes.Add(1)
+			revoked.Store(false)
+			w.Write([]byte(`{"accessToken": "access-2", "refreshToken": "refresh-2"}`))
+		default:
+			if revoked.Load() {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer svr.Close()
+	client := newTestClient(t, svr)
+	// A literal without Now uses time.Now.
+	client.Authenticator = &TokenAuth{Email: "max@example.com", Password: "secret", client: client}
+
+	// A token without expiresIn is used until it is rejected.
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetSensors("sm1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revoked.Store(true)
+	if _, err := client.GetSensors("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if logins.Load() != 1 || refreshes.Load() != 1 {
+		t.Fatalf("expected a single login and refresh, got %d logins and %d refreshes", logins.Load(), refreshes.Load())
+	}
+
+	if _, err := (&TokenAuth{}).Token(context.Background()); err == nil {
+		t.Fatal("expected error without client")
+	}
+}
+
+func TestNewClientWithOptions(t *testing.T) {
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "secret" || r.URL.Path != "/api/v1/info/sensors/sm1" || r.UserAgent() != "myapp/1.0 go-solarmanager" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer svr.Close()
+
+	httpClient := &http.Client{}
+	limiter := &countingLimiter{}
+	var logs bytes.Buffer
+	client, err := NewClientWithOptions(
+		WithBaseURL(svr.URL+"/api"),
+		WithHTTPClient(httpClient),
+		WithBasicAuth("user", "secret"),
+		WithTimeout(time.Second),
+		WithUserAgent("myapp/1.0"),
+		WithLogger(log.New(&logs, "", 0)),
+		WithRetryPolicy(RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond}),
+		WithLimiter(limiter),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Verbose = true
+	if _, err := client.GetSensors("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+	if n := limiter.n.Load(); n != 3 {
+		t.Fatalf("expected limiter to be waited on 3 times, got %d", n)
+	}
+	if !strings.Contains(logs.String(), "retrying GET") {
+		t.Fatalf("expected retries to be logged, got:\n%s", logs.String())
+	}
+	if httpClient.Timeout != 0 {
+		t.Fatal("HTTP client was modified")
+	}
+
+	// Retries are exhausted.
+	calls.Store(-10)
+	var errorResponse *ErrorResponse
+	if _, err := client.GetSensors("sm1"); !errors.As(err, &errorResponse) || errorResponse.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, opts := range [][]Option{
+		{WithBaseURL("cloud.solar-manager.ch")},
+		{WithBaseURL("ftp://cloud.solar-manager.ch/")},
+		{WithHTTPClient(nil)},
+		{WithTimeout(-time.Second)},
+		{WithUserAgent("")},
+		{WithRetryPolicy(RetryPolicy{MaxRetries: 1, MinBackoff: time.Minute, MaxBackoff: time.Second})},
+		{WithBasicAuth("user", "secret"), WithTokenAuth("user", "secret", nil)},
+	} {
+		if _, err := NewClientWithOptions(opts...); err == nil {
+			t.Fatalf("expected error for options %d", len(opts))
+		}
+	}
+}
+
+func TestOpenTelemetry(t *testing.T) {
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/stream/sensor/sm1/s1" && calls.Add(1) == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/v1/stream/sensor/sm1/s1":
+			w.Write([]byte(`{"data": {"_id": "s1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	client, err := NewClientWithOptions(
+		WithBaseURL(svr.URL),
+		WithRetryPolicy(RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond}),
+		WithOpenTelemetry(tp, mp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetSensorData("sm1", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetGatewayData("sm2"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "GetSensorData" || spans[1].Name != "GetGatewayData" {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+	attrs := func(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range s.Attributes {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+	a := attrs(spans[0])
+	if a["solarmanager.sm_id"].AsString() != "sm1" || a["solarmanager.sensor_id"].AsString() != "s1" || a["http.response.status_code"].AsInt64() != 200 {
+		t.Fatalf("unexpected attributes %v", spans[0].Attributes)
+	}
+	if len(spans[0].Events) != 1 || spans[0].Events[0].Name != "retry" || spans[0].Status.Code != otelcodes.Unset {
+		t.Fatalf("unexpected events %+v", spans[0].Events)
+	}
+	if a := attrs(spans[1]); a["http.response.status_code"].AsInt64() != 404 || spans[1].Status.Code != otelcodes.Error {
+		t.Fatalf("unexpected span %+v", spans[1])
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]uint64)
+	checkKeys := func(set attribute.Set) {
+		for _, kv := range set.ToSlice() {
+			switch kv.Key {
+			case "solarmanager.operation", "http.request.method", "http.response.status_code", "error.type":
+			default:
+				t.Errorf("unexpected metric attribute %v", kv)
+			}
+		}
+	}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Histogram[float64]:
+			for _, p := range data.DataPoints {
+				checkKeys(p.Attributes)
+				counts[m.Name] += p.Count
+			}
+		case metricdata.Sum[int64]:
+			for _, p := range data.DataPoints {
+				checkKeys(p.Attributes)
+				counts[m.Name] += uint64(p.Value)
+			}
+		}
+	}
+	expected := map[string]uint64{"solarmanager.client.request.duration": 2, "solarmanager.client.request.errors": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("unexpected metrics %v", counts)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("X-Tenant") != "acme" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/v1/stream/gateway/offline" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"currentPvGeneration": 1000}`))
+	}))
+	defer svr.Close()
+
+	var events []string
+	cached := `[{"_id": "cached"}]`
+	client, err := NewClientWithOptions(
+		WithBaseURL(svr.URL),
+		WithRetryPolicy(RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond}),
+		WithMiddleware(Hooks{
+			BeforeRequest: func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+				events = append(events, "before 1 "+op.Name)
+				req.Header.Set("X-Tenant", "acme")
+				return nil, nil
+			},
+			AfterResponse: func(ctx context.Context, op Operation, req *http.Request, resp *http.Response) {
+				events = append(events, fmt.Sprintf("after 1 %s %d", op.Name, resp.StatusCode))
+			},
+			OnError: func(ctx context.Context, op Operation, req *http.Request, err error) {
+				events = append(events, fmt.Sprintf("error 1 %s %+v", op.Name, op.Params))
+			},
+		}.Middleware()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Use(Hooks{
+		BeforeRequest: func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+			events = append(events, "before 2 "+op.Name)
+			if p, ok := op.Params.(GatewayParams); ok && op.Name == "GetSensors" && p.SmID == "sm1" {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(cached))}, nil
+			}
+			return nil, nil
+		},
+	}.Middleware())
+
+	sensors, err := client.GetSensors("sm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 1 || sensors[0].Id != "cached" || calls.Load() != 0 {
+		t.Fatalf("expected cached response, got %+v after %d calls", sensors, calls.Load())
+	}
+	data, err := client.GetGatewayData("sm1")
+	if err != nil || data.CurrentPvGeneration != 1000 {
+		t.Fatalf("unexpected response %+v, %v", data, err)
+	}
+	if _, err := client.GetGatewayData("offline"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := []string{
+		"before 1 GetSensors", "before 2 GetSensors", "after 1 GetSensors 200",
+		"before 1 GetGatewayData", "before 2 GetGatewayData", "after 1 GetGatewayData 200",
+		// Retries are not seen by middleware.
+		"before 1 GetGatewayData", "before 2 GetGatewayData", "error 1 GetGatewayData {SmID:offline}",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("unexpected events %q", events)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Fatalf("expected 4 requests, got %d", n)
+	}
+}
@@ -0,0 +1,151 @@
+package solarmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package as the source of spans and
+// metrics.
+const instrumentationName = "github.com/ingmarstein/solarmanager-go/solarmanager"
+
+// telemetry records a span and metrics per API call.
+type telemetry struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) (*telemetry, error) {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+	duration, err := meter.Float64Histogram("solarmanager.client.request.duration",
+		metric.WithDescription("Duration of SolarManager API calls, including retries."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	errs, err := meter.Int64Counter("solarmanager.client.request.errors",
+		metric.WithDescription("Number of failed SolarManager API calls."),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		return nil, err
+	}
+	return &telemetry{
+		tracer:   tp.Tracer(instrumentationName),
+		duration: duration,
+		errors:   errs,
+	}, nil
+}
+
+// span is an API call in progress.
+type span struct {
+	t     *telemetry
+	span  trace.Span
+	attrs []attribute.KeyValue // of the metrics
+	start time.Time
+}
+
+// middleware traces the call and records its metrics.
+func (t *telemetry) middleware(next Handler) Handler {
+	return func(ctx context.Context, op Operation, req *http.Request) (*http.Response, error) {
+		ctx, s := t.start(ctx, op, req)
+		resp, err := next(ctx, op, req.WithContext(ctx))
+		s.end(resp, err)
+		return resp, err
+	}
+}
+
+// start starts the span of op, which sends req. The SolarManager and sensor
+// IDs are only set on the span; as metric attributes, their unbounded
+// number of values would create a time series per device.
+func (t *telemetry) start(ctx context.Context, op Operation, req *http.Request) (context.Context, *span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("solarmanager.operation", op.Name),
+		attribute.String("http.request.method", req.Method),
+	}
+	ids := make([]attribute.KeyValue, 0, 2)
+	smID, sensorID := op.ids()
+	if smID != "" {
+		ids = append(ids, attribute.String("solarmanager.sm_id", smID))
+	}
+	if sensorID != "" {
+		ids = append(ids, attribute.String("solarmanager.sensor_id", sensorID))
+	}
+	ctx, s := t.tracer.Start(ctx, op.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(ids...),
+		trace.WithAttributes(
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("url.full", req.URL.String()),
+		))
+	return ctx, &span{t: t, span: s, attrs: attrs, start: time.Now()}
+}
+
+// end ends the span and records the metrics of the call.
+func (s *span) end(resp *http.Response, err error) {
+	attrs := s.attrs
+	if resp != nil {
+		status := attribute.Int("http.response.status_code", resp.StatusCode)
+		s.span.SetAttributes(status)
+		attrs = append(attrs, status)
+	}
+	if err != nil {
+		errType := attribute.String("error.type", errorType(err))
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+		s.span.SetAttributes(errType)
+		attrs = append(attrs, errType)
+	}
+	ctx := context.Background()
+	s.t.duration.Record(ctx, time.Since(s.start).Seconds(), metric.WithAttributes(attrs...))
+	if err != nil {
+		s.t.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	s.span.End()
+}
+
+// addRetryEvent records retry n of the call traced in ctx, if any, after
+// the previous attempt failed with err.
+func addRetryEvent(ctx context.Context, n int, delay time.Duration, err error) {
+	s := trace.SpanFromContext(ctx)
+	if !s.IsRecording() {
+		return
+	}
+	s.AddEvent("retry", trace.WithAttributes(
+		attribute.Int("retry.attempt", n),
+		attribute.String("retry.delay", delay.String()),
+		attribute.String("error.type", errorType(err)),
+	))
+}
+
+// errorType returns the value of the error.type attribute: the status code
+// for API errors, the context error or the Go type of err.
+func errorType(err error) string {
+	var errorResponse *ErrorResponse
+	switch {
+	case errors.As(err, &errorResponse):
+		return strconv.Itoa(errorResponse.Response.StatusCode)
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return fmt.Sprintf("%T", err)
+}
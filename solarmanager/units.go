@@ -0,0 +1,114 @@
+package solarmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Watt is a power in W. It decodes from JSON integers, floats and numeric
+// strings, since the API is not consistent about which it returns.
+type Watt float64
+
+// WattHour is an energy in Wh. It decodes like Watt.
+type WattHour float64
+
+// Kilowatts returns w in kW.
+func (w Watt) Kilowatts() float64 {
+	return float64(w) / 1000
+}
+
+// String formats w rounded to two decimals, in kW from 1000 W upwards,
+// e.g. "494 W" or "1.5 kW".
+func (w Watt) String() string {
+	return formatUnit(float64(w), "W")
+}
+
+func (w *Watt) UnmarshalJSON(data []byte) error {
+	_, err := w.decode(data)
+	return err
+}
+
+func (w *Watt) decode(data []byte) (bool, error) {
+	f, ok, err := decodeNumber(data)
+	if ok {
+		*w = Watt(f)
+	}
+	return ok, err
+}
+
+// KilowattHours returns e in kWh.
+func (e WattHour) KilowattHours() float64 {
+	return float64(e) / 1000
+}
+
+// String formats e rounded to two decimals, in kWh from 1000 Wh upwards,
+// e.g. "120.83 Wh" or "12.5 kWh".
+func (e WattHour) String() string {
+	return formatUnit(float64(e), "Wh")
+}
+
+func (e *WattHour) UnmarshalJSON(data []byte) error {
+	_, err := e.decode(data)
+	return err
+}
+
+func (e *WattHour) decode(data []byte) (bool, error) {
+	f, ok, err := decodeNumber(data)
+	if ok {
+		*e = WattHour(f)
+	}
+	return ok, err
+}
+
+// numberDecoder is implemented by Watt and WattHour. decode is UnmarshalJSON,
+// but also reports whether the value was set, so that Optional can leave a
+// mismatched value absent.
+type numberDecoder interface {
+	decode(data []byte) (ok bool, err error)
+}
+
+func formatUnit(v float64, unit string) string {
+	if math.Abs(v) >= 1000 {
+		v /= 1000
+		unit = "k" + unit
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64) + " " + unit
+}
+
+// decodeNumber decodes a JSON number or numeric string. It reports ok ==
+// false without an error for null and for values that are not numbers,
+// leaving the value unchanged like encoding/json does for a mismatched field.
+// Returning an UnmarshalTypeError would abort decoding the enclosing object,
+// see decodeWithExtra.
+func decodeNumber(data []byte) (f float64, ok bool, err error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return 0, false, err
+	}
+	f, ok = parseNumber(v)
+	return f, ok, nil
+}
+
+// parseNumber returns the value of a JSON number or numeric string decoded
+// with UseNumber. Non-finite values like "NaN" or "Inf" are not numbers.
+func parseNumber(v interface{}) (float64, bool) {
+	var f float64
+	var err error
+	switch v := v.(type) {
+	case json.Number:
+		f, err = v.Float64()
+	case string:
+		f, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, false
+	}
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
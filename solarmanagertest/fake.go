@@ -0,0 +1,217 @@
+package solarmanagertest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// Call is a recorded call of a Fake method.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Fake is an implementation of solarmanager.API for unit tests that don't
+// need an HTTP server. Each method records the call and then calls the
+// corresponding Func field. If the field is nil, the zero response and a nil
+// error are returned. The Context variants share the Func field of the plain
+// method and are recorded under their own name without the context. They
+// return the context's error if it is done. Fake is safe for concurrent use
+// as long as the Func fields are not modified while it is in use.
+type Fake struct {
+	GetGatewayInfoFunc                  func(solarManagerID string) (solarmanager.GetGatewayInfoResponse, error)
+	GetSensorsFunc                      func(solarManagerID string) (solarmanager.GetSensorsResponse, error)
+	GetSensorFunc                       func(sensorID string) (solarmanager.GetSensorResponse, error)
+	GetGatewayDataFunc                  func(solarManagerID string) (solarmanager.GetGatewayDataResponse, error)
+	GetSensorConsumptionStatisticsFunc  func(sensorID string, period solarmanager.StatisticPeriod) (solarmanager.GetSensorConsumptionStatisticsResponse, error)
+	GetGatewayConsumptionStatisticsFunc func(solarManagerID string, period solarmanager.StatisticPeriod) (solarmanager.GetGatewayConsumptionStatisticsResponse, error)
+	GetSensorDataFunc                   func(solarManagerID string, sensorID string) (solarmanager.GetSensorDataResponse, error)
+	GetGatewayPieChartFunc              func(solarManagerID string) (solarmanager.GetGatewayPieChartResponse, error)
+	GetGatewayForecastFunc              func(solarManagerID string) (solarmanager.GetGatewayForecastResponse, error)
+	GetLowRateTariffFunc                func(solarManagerID string) (solarmanager.GetLowRateTariffResponse, error)
+	GetAllSensorDataFunc                func(solarManagerID string, concurrency int) (map[string]solarmanager.GetSensorDataResponse, error)
+	// ListUsersFunc and ListGatewaysFunc return a page of the listing.
+	// Pages are numbered from 1.
+	ListUsersFunc    func(page, pageSize int) ([]solarmanager.User, error)
+	ListGatewaysFunc func(page, pageSize int) ([]solarmanager.GatewayInfo, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ solarmanager.API = (*Fake)(nil)
+
+func (f *Fake) record(method string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns all calls made so far, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the calls made so far to the given method, in order.
+func (f *Fake) CallsTo(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []Call
+	for _, c := range f.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset clears the recorded calls.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// call records a call of method with args and returns the result of fn, or
+// the zero response if fn is nil. If ctx is done, its error is returned
+// instead.
+func call[T any](f *Fake, ctx context.Context, method string, fn func() (T, error), args ...interface{}) (T, error) {
+	f.record(method, args...)
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	if fn == nil {
+		return zero, nil
+	}
+	return fn()
+}
+
+// bind returns a call of the Func field fn with the given argument, or nil
+// if fn is nil.
+func bind[A, T any](fn func(A) (T, error), a A) func() (T, error) {
+	if fn == nil {
+		return nil
+	}
+	return func() (T, error) { return fn(a) }
+}
+
+// bind2 is like bind for Func fields with two arguments.
+func bind2[A, B, T any](fn func(A, B) (T, error), a A, b B) func() (T, error) {
+	if fn == nil {
+		return nil
+	}
+	return func() (T, error) { return fn(a, b) }
+}
+
+func (f *Fake) GetGatewayInfo(solarManagerID string) (solarmanager.GetGatewayInfoResponse, error) {
+	return call(f, context.Background(), "GetGatewayInfo", bind(f.GetGatewayInfoFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetSensors(solarManagerID string) (solarmanager.GetSensorsResponse, error) {
+	return call(f, context.Background(), "GetSensors", bind(f.GetSensorsFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetSensor(sensorID string) (solarmanager.GetSensorResponse, error) {
+	return call(f, context.Background(), "GetSensor", bind(f.GetSensorFunc, sensorID), sensorID)
+}
+
+func (f *Fake) GetGatewayData(solarManagerID string) (solarmanager.GetGatewayDataResponse, error) {
+	return call(f, context.Background(), "GetGatewayData", bind(f.GetGatewayDataFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetSensorConsumptionStatistics(sensorID string, period solarmanager.StatisticPeriod) (solarmanager.GetSensorConsumptionStatisticsResponse, error) {
+	return call(f, context.Background(), "GetSensorConsumptionStatistics", bind2(f.GetSensorConsumptionStatisticsFunc, sensorID, period), sensorID, period)
+}
+
+func (f *Fake) GetGatewayConsumptionStatistics(solarManagerID string, period solarmanager.StatisticPeriod) (solarmanager.GetGatewayConsumptionStatisticsResponse, error) {
+	return call(f, context.Background(), "GetGatewayConsumptionStatistics", bind2(f.GetGatewayConsumptionStatisticsFunc, solarManagerID, period), solarManagerID, period)
+}
+
+func (f *Fake) GetSensorData(solarManagerID string, sensorID string) (solarmanager.GetSensorDataResponse, error) {
+	return call(f, context.Background(), "GetSensorData", bind2(f.GetSensorDataFunc, solarManagerID, sensorID), solarManagerID, sensorID)
+}
+
+func (f *Fake) GetGatewayPieChart(solarManagerID string) (solarmanager.GetGatewayPieChartResponse, error) {
+	return call(f, context.Background(), "GetGatewayPieChart", bind(f.GetGatewayPieChartFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetGatewayForecast(solarManagerID string) (solarmanager.GetGatewayForecastResponse, error) {
+	return call(f, context.Background(), "GetGatewayForecast", bind(f.GetGatewayForecastFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetLowRateTariff(solarManagerID string) (solarmanager.GetLowRateTariffResponse, error) {
+	return call(f, context.Background(), "GetLowRateTariff", bind(f.GetLowRateTariffFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetGatewayInfoContext(ctx context.Context, solarManagerID string) (solarmanager.GetGatewayInfoResponse, error) {
+	return call(f, ctx, "GetGatewayInfoContext", bind(f.GetGatewayInfoFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetSensorsContext(ctx context.Context, solarManagerID string) (solarmanager.GetSensorsResponse, error) {
+	return call(f, ctx, "GetSensorsContext", bind(f.GetSensorsFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetSensorContext(ctx context.Context, sensorID string) (solarmanager.GetSensorResponse, error) {
+	return call(f, ctx, "GetSensorContext", bind(f.GetSensorFunc, sensorID), sensorID)
+}
+
+func (f *Fake) GetGatewayDataContext(ctx context.Context, solarManagerID string) (solarmanager.GetGatewayDataResponse, error) {
+	return call(f, ctx, "GetGatewayDataContext", bind(f.GetGatewayDataFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetSensorConsumptionStatisticsContext(ctx context.Context, sensorID string, period solarmanager.StatisticPeriod) (solarmanager.GetSensorConsumptionStatisticsResponse, error) {
+	return call(f, ctx, "GetSensorConsumptionStatisticsContext", bind2(f.GetSensorConsumptionStatisticsFunc, sensorID, period), sensorID, period)
+}
+
+func (f *Fake) GetGatewayConsumptionStatisticsContext(ctx context.Context, solarManagerID string, period solarmanager.StatisticPeriod) (solarmanager.GetGatewayConsumptionStatisticsResponse, error) {
+	return call(f, ctx, "GetGatewayConsumptionStatisticsContext", bind2(f.GetGatewayConsumptionStatisticsFunc, solarManagerID, period), solarManagerID, period)
+}
+
+func (f *Fake) GetSensorDataContext(ctx context.Context, solarManagerID string, sensorID string) (solarmanager.GetSensorDataResponse, error) {
+	return call(f, ctx, "GetSensorDataContext", bind2(f.GetSensorDataFunc, solarManagerID, sensorID), solarManagerID, sensorID)
+}
+
+func (f *Fake) GetGatewayPieChartContext(ctx context.Context, solarManagerID string) (solarmanager.GetGatewayPieChartResponse, error) {
+	return call(f, ctx, "GetGatewayPieChartContext", bind(f.GetGatewayPieChartFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetGatewayForecastContext(ctx context.Context, solarManagerID string) (solarmanager.GetGatewayForecastResponse, error) {
+	return call(f, ctx, "GetGatewayForecastContext", bind(f.GetGatewayForecastFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetLowRateTariffContext(ctx context.Context, solarManagerID string) (solarmanager.GetLowRateTariffResponse, error) {
+	return call(f, ctx, "GetLowRateTariffContext", bind(f.GetLowRateTariffFunc, solarManagerID), solarManagerID)
+}
+
+func (f *Fake) GetAllSensorData(ctx context.Context, solarManagerID string, concurrency int) (map[string]solarmanager.GetSensorDataResponse, error) {
+	return call(f, ctx, "GetAllSensorData", bind2(f.GetAllSensorDataFunc, solarManagerID, concurrency), solarManagerID, concurrency)
+}
+
+// ListUsers records a "ListUsers" call with the page and page size for
+// every page fetched.
+func (f *Fake) ListUsers(ctx context.Context, opts *solarmanager.ListOptions) *solarmanager.Iterator[solarmanager.User] {
+	return solarmanager.NewIterator(ctx, opts, func(ctx context.Context, page, pageSize int) ([]solarmanager.User, error) {
+		f.record("ListUsers", page, pageSize)
+		if f.ListUsersFunc == nil {
+			return nil, nil
+		}
+		return f.ListUsersFunc(page, pageSize)
+	})
+}
+
+// ListGateways records a "ListGateways" call with the page and page size for
+// every page fetched.
+func (f *Fake) ListGateways(ctx context.Context, opts *solarmanager.ListOptions) *solarmanager.Iterator[solarmanager.GatewayInfo] {
+	return solarmanager.NewIterator(ctx, opts, func(ctx context.Context, page, pageSize int) ([]solarmanager.GatewayInfo, error) {
+		f.record("ListGateways", page, pageSize)
+		if f.ListGatewaysFunc == nil {
+			return nil, nil
+		}
+		return f.ListGatewaysFunc(page, pageSize)
+	})
+}
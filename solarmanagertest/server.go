@@ -0,0 +1,518 @@
+// Package solarmanagertest provides an in-memory fake of the SolarManager API
+// for use in tests of code built on the solarmanager package.
+package solarmanagertest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// Gateway is the state of a single fake SolarManager gateway. Live gateway
+// data and the pie chart are derived from it, so all endpoints stay
+// consistent with each other.
+type Gateway struct {
+	Info    solarmanager.GetGatewayInfoResponse
+	Sensors []solarmanager.SensorInfo
+	// Readings holds the live data of each sensor, keyed by SensorInfo.Id.
+	Readings map[string]solarmanager.SensorData
+
+	Production             solarmanager.Watt // current PV generation
+	Consumption            solarmanager.Watt // current power consumption
+	BatteryChargeDischarge solarmanager.Watt // positive when charging, negative when discharging
+	BatteryCapacity        int               // battery state of charge in %
+
+	Forecast solarmanager.GetGatewayForecastResponse
+	Tariff   solarmanager.GetLowRateTariffResponse
+	// GatewayStatistics and SensorStatistics are keyed by period; sensor
+	// statistics additionally by sensor id.
+	GatewayStatistics map[solarmanager.StatisticPeriod]solarmanager.GetGatewayConsumptionStatisticsResponse
+	SensorStatistics  map[string]map[solarmanager.StatisticPeriod]solarmanager.GetSensorConsumptionStatisticsResponse
+}
+
+// NewGateway returns a gateway with a water heater and a car charger,
+// producing 20 kW of which 5 kW are consumed locally.
+func NewGateway(smID string) *Gateway {
+	g := &Gateway{
+		Readings:    make(map[string]solarmanager.SensorData),
+		Production:  20000,
+		Consumption: 5000,
+		Tariff: solarmanager.GetLowRateTariffResponse{
+			MondayFridayFrom: "20:00", MondayFridayTo: "07:00",
+			SatudayFrom: "13:00", SatudayTo: "07:00",
+			SundayFrom: "00:00", SundayTo: "07:00",
+		},
+		GatewayStatistics: make(map[solarmanager.StatisticPeriod]solarmanager.GetGatewayConsumptionStatisticsResponse),
+		SensorStatistics:  make(map[string]map[solarmanager.StatisticPeriod]solarmanager.GetSensorConsumptionStatisticsResponse),
+	}
+	g.Info.Gateway = solarmanager.GatewayInfo{
+		Id:       "gw-" + smID,
+		Signal:   "connected",
+		Name:     smID,
+		SmId:     smID,
+		Firmware: "0.20.1",
+		Mac:      "2C:3E:51:00:00:00",
+		Ip:       "192.168.1.51",
+	}
+	g.Info.Settings.KWp = 24.5
+	g.Info.Settings.TariffType = "double"
+	g.Info.User = solarmanager.User{UserId: "user-" + smID, Status: "active"}
+
+	created := time.Date(2019, 10, 16, 11, 23, 43, 0, time.UTC)
+	g.AddSensor(solarmanager.SensorInfo{
+		Id: smID + "-heater", Priority: 7, DeviceType: "device", Signal: "connected",
+		Type: "Water Heater", DeviceGroup: "myPV AC THOR", CreatedAt: created, UpdatedAt: created,
+	}, solarmanager.SensorData{CurrentPower: solarmanager.Some[solarmanager.Watt](3000), CurrentWaterTemp: solarmanager.Some(44)})
+	g.AddSensor(solarmanager.SensorInfo{
+		Id: smID + "-wallbox", Priority: 5, DeviceType: "device", Signal: "connected",
+		Type: "Car Charging", DeviceGroup: "KEBA Wallbox P30", CreatedAt: created, UpdatedAt: created,
+	}, solarmanager.SensorData{CurrentPower: solarmanager.Some[solarmanager.Watt](2000)})
+
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		g.Forecast = append(g.Forecast, solarmanager.ForecastEntry{
+			Timestamp: start.Add(time.Duration(i) * 15 * time.Minute).UnixMilli(),
+			Expected:  1700, Min: 1100, Max: 2200,
+		})
+	}
+	return g
+}
+
+// AddSensor adds a sensor with its live data to the gateway.
+func (g *Gateway) AddSensor(info solarmanager.SensorInfo, data solarmanager.SensorData) {
+	data.Id = info.Id
+	if data.Signal == "" {
+		data.Signal = info.Signal
+	}
+	if data.Errors == nil {
+		data.Errors = []int{}
+	}
+	g.Sensors = append(g.Sensors, info)
+	g.Readings[info.Id] = data
+}
+
+func (g *Gateway) data(now time.Time) solarmanager.GetGatewayDataResponse {
+	d := solarmanager.GetGatewayDataResponse{
+		InterfaceVersion:              "1.0",
+		TimeStamp:                     now,
+		CurrentBatteryChargeDischarge: g.BatteryChargeDischarge,
+		CurrentPowerConsumption:       g.Consumption,
+		CurrentPvGeneration:           g.Production,
+		Errors:                        []int{},
+		Soc:                           g.BatteryCapacity,
+	}
+	for _, s := range g.Sensors {
+		d.Devices = append(d.Devices, g.Readings[s.Id])
+	}
+	return d
+}
+
+// pieChart distributes production, battery and grid power onto the
+// consumers the way the SolarManager pie chart does: PV covers consumption
+// first, then charges the battery, and any surplus is fed into the grid.
+func (g *Gateway) pieChart(now time.Time) solarmanager.GetGatewayPieChartResponse {
+	var c solarmanager.GetGatewayPieChartResponse
+	c.LastUpdate = now
+	c.Production = g.Production
+	c.Consumption = g.Consumption
+	c.Battery.Capacity = g.BatteryCapacity
+
+	pvToConsumer := min(g.Production, g.Consumption)
+	surplus := g.Production - pvToConsumer
+	deficit := g.Consumption - pvToConsumer
+	var pvToBattery, gridToBattery, batteryToConsumer solarmanager.Watt
+	if g.BatteryChargeDischarge > 0 {
+		c.Battery.BatteryCharging = g.BatteryChargeDischarge
+		pvToBattery = min(surplus, g.BatteryChargeDischarge)
+		surplus -= pvToBattery
+		gridToBattery = g.BatteryChargeDischarge - pvToBattery
+	} else if g.BatteryChargeDischarge < 0 {
+		c.Battery.BatteryDischarging = -g.BatteryChargeDischarge
+		batteryToConsumer = min(deficit, -g.BatteryChargeDischarge)
+		deficit -= batteryToConsumer
+	}
+
+	c.Arrows = []solarmanager.PieChartArrow{
+		{Direction: "fromPVToGrid", Value: surplus},
+		{Direction: "fromGridToConsumer", Value: deficit},
+		{Direction: "fromPVToConsumer", Value: pvToConsumer},
+	}
+	for _, a := range []solarmanager.PieChartArrow{
+		{Direction: "fromPVToBattery", Value: pvToBattery},
+		{Direction: "fromGridToBattery", Value: gridToBattery},
+		{Direction: "fromBatteryToConsumer", Value: batteryToConsumer},
+	} {
+		if a.Value != 0 {
+			c.Arrows = append(c.Arrows, a)
+		}
+	}
+	return c
+}
+
+// ControlWrite is a write request received on a /v1/control/ endpoint.
+type ControlWrite struct {
+	Method   string
+	Path     string
+	SensorID string
+	Body     json.RawMessage
+}
+
+type fault struct {
+	prefix string
+	status int
+	count  int
+}
+
+// Server is a fake SolarManager API server. It requires HTTP Basic
+// authentication with the configured credentials. Its methods are safe for
+// concurrent use, including while requests are being served.
+type Server struct {
+	*httptest.Server
+
+	// Now returns the time used for live data. It defaults to time.Now.
+	Now func() time.Time
+
+	username string
+	password string
+
+	mu       sync.Mutex
+	gateways map[string]*Gateway
+	writes   []ControlWrite
+	faults   []*fault
+	latency  time.Duration
+	requests int
+}
+
+// NewServer starts and returns a new fake server accepting the given
+// credentials. The caller should call Close when finished, to shut it down.
+func NewServer(username, password string) *Server {
+	s := &Server{
+		Now:      time.Now,
+		username: username,
+		password: password,
+		gateways: make(map[string]*Gateway),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewClient returns a SolarManager client configured to use the server with
+// its credentials.
+func (s *Server) NewClient() *solarmanager.Client {
+	return solarmanager.NewClient(s.Server.Client(), s.BaseURL(), s.username, s.password)
+}
+
+// BaseURL returns the URL to be passed to solarmanager.NewClient.
+func (s *Server) BaseURL() *url.URL {
+	u, _ := url.Parse(s.URL + "/")
+	return u
+}
+
+// AddGateway registers a gateway under its SolarManager ID, replacing any
+// existing one.
+func (s *Server) AddGateway(g *Gateway) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gateways[g.Info.Gateway.SmId] = g
+}
+
+// UpdateGateway calls f with the gateway registered for smID while holding
+// the server lock. It reports whether the gateway exists.
+func (s *Server) UpdateGateway(smID string, f func(g *Gateway)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.gateways[smID]
+	if ok {
+		f(g)
+	}
+	return ok
+}
+
+// Writes returns the control writes received so far.
+func (s *Server) Writes() []ControlWrite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ControlWrite(nil), s.writes...)
+}
+
+// Requests returns the number of requests received so far, including failed
+// ones.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Fail makes the next count requests whose path starts with pathPrefix fail
+// with the given HTTP status. A count of zero fails them until ClearFaults is
+// called. An empty prefix matches all requests.
+func (s *Server) Fail(pathPrefix string, status, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{prefix: pathPrefix, status: status, count: count})
+}
+
+// ClearFaults removes all failures registered with Fail.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+func (s *Server) fault(path string) int {
+	for i, f := range s.faults {
+		if !strings.HasPrefix(path, f.prefix) {
+			continue
+		}
+		if f.count > 0 {
+			f.count--
+			if f.count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f.status
+	}
+	return 0
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": http.StatusText(status)})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	latency := s.latency
+	status := s.fault(r.URL.Path)
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		writeError(w, status)
+		return
+	}
+	if u, p, ok := r.BasicAuth(); !ok || u != s.username || p != s.password {
+		w.Header().Set("WWW-Authenticate", `Basic realm="SolarManager"`)
+		writeError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/v1/control/") {
+		s.serveControl(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	v, ok := s.lookup(r)
+	if !ok {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// lookup returns the response for a GET request.
+func (s *Server) lookup(r *http.Request) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	period := solarmanager.StatisticPeriod(r.URL.Query().Get("period"))
+	now := s.Now().UTC()
+	gateway := func(smID string) (*Gateway, bool) {
+		g, ok := s.gateways[smID]
+		return g, ok
+	}
+
+	switch {
+	case match(parts, "v1", "info", "gateway", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			return g.Info, true
+		}
+	case match(parts, "v1", "info", "sensors", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			return append(solarmanager.GetSensorsResponse{}, g.Sensors...), true
+		}
+	case match(parts, "v1", "info", "sensor", "*"):
+		for _, g := range s.gateways {
+			for _, info := range g.Sensors {
+				if info.Id == parts[3] {
+					return info, true
+				}
+			}
+		}
+	case match(parts, "v1", "stream", "gateway", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			return g.data(now), true
+		}
+	case match(parts, "v1", "stream", "sensor", "*", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			if d, ok := g.Readings[parts[4]]; ok {
+				return solarmanager.GetSensorDataResponse{Date: now, Data: d}, true
+			}
+		}
+	case match(parts, "v1", "consumption", "gateway", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			st, ok := g.GatewayStatistics[period]
+			if !ok {
+				st.GatewayId = g.Info.Gateway.Id
+				st.Period = string(period)
+			}
+			return st, true
+		}
+	case match(parts, "v1", "consumption", "sensor", "*"):
+		for _, g := range s.gateways {
+			if _, ok := g.Readings[parts[3]]; !ok {
+				continue
+			}
+			st, ok := g.SensorStatistics[parts[3]][period]
+			if !ok {
+				st.SensorId = parts[3]
+				st.Period = string(period)
+			}
+			return st, true
+		}
+	case match(parts, "v1", "chart", "gateway", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			return g.pieChart(now), true
+		}
+	case match(parts, "v1", "forecast", "gateways", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			return append(solarmanager.GetGatewayForecastResponse{}, g.Forecast...), true
+		}
+	case match(parts, "v1", "low-rate-tariff", "gateways", "*"):
+		if g, ok := gateway(parts[3]); ok {
+			return g.Tariff, true
+		}
+	case match(parts, "v1", "gateways"):
+		gateways := []solarmanager.GatewayInfo{}
+		for _, g := range s.sortedGateways() {
+			gateways = append(gateways, g.Info.Gateway)
+		}
+		return paginate(gateways, r.URL.Query()), true
+	case match(parts, "v1", "users"):
+		users := []solarmanager.User{}
+		for _, g := range s.sortedGateways() {
+			users = append(users, g.Info.User)
+		}
+		return paginate(users, r.URL.Query()), true
+	}
+	return nil, false
+}
+
+func (s *Server) sortedGateways() []*Gateway {
+	ids := make([]string, 0, len(s.gateways))
+	for id := range s.gateways {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	gateways := make([]*Gateway, len(ids))
+	for i, id := range ids {
+		gateways[i] = s.gateways[id]
+	}
+	return gateways
+}
+
+// paginate returns the page of items selected by the page (starting at 1)
+// and limit query parameters. Without a limit, all items are returned.
+func paginate[T any](items []T, query url.Values) []T {
+	page, _ := strconv.Atoi(query.Get("page"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		return items
+	}
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * limit
+	if start >= len(items) {
+		return items[:0]
+	}
+	return items[start:min(start+limit, len(items))]
+}
+
+// serveControl records writes to /v1/control/<device>/<sensor id> and merges
+// a JSON object body into the live data of that sensor.
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil || (len(body) > 0 && !json.Valid(body)) {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	sensorID := parts[len(parts)-1]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	for _, g := range s.gateways {
+		d, ok := g.Readings[sensorID]
+		if !ok {
+			continue
+		}
+		found = true
+		if len(body) > 0 {
+			// Unknown keys are ignored, known ones update the live data.
+			json.Unmarshal(body, &d)
+			d.Id = sensorID
+			g.Readings[sensorID] = d
+		}
+	}
+	if !found {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	s.writes = append(s.writes, ControlWrite{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		SensorID: sensorID,
+		Body:     body,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// match reports whether the path parts equal pattern, where "*" matches any
+// single non-empty part.
+func match(parts []string, pattern ...string) bool {
+	if len(parts) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if parts[i] == "" || (p != "*" && p != parts[i]) {
+			return false
+		}
+	}
+	return true
+}
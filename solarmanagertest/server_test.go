@@ -0,0 +1,276 @@
+package solarmanagertest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := NewServer("user", "secret")
+	t.Cleanup(s.Close)
+	s.AddGateway(NewGateway("sm1"))
+	return s
+}
+
+func TestConsistentData(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Date(2021, 2, 1, 16, 9, 39, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	c := s.NewClient()
+
+	sensors, err := c.GetSensors("sm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 2 {
+		t.Fatalf("unexpected number of sensors, expected 2, but got %d", len(sensors))
+	}
+
+	data, err := c.GetGatewayData("sm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.TimeStamp.Equal(now) || len(data.Devices) != len(sensors) || data.Devices[0].Id != sensors[0].Id {
+		t.Fatalf("gateway data inconsistent with sensors: %+v", data)
+	}
+
+	sensor, err := c.GetSensorData("sm1", sensors[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Data.CurrentPower != data.Devices[0].CurrentPower {
+		t.Fatalf("sensor data inconsistent with gateway data: %+v", sensor)
+	}
+
+	info, err := c.GetSensor(sensors[1].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DeviceGroup != "KEBA Wallbox P30" {
+		t.Fatalf("unexpected device group %q", info.DeviceGroup)
+	}
+
+	chart, err := c.GetGatewayPieChart("sm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrows := make(map[string]solarmanager.Watt)
+	for _, a := range chart.Arrows {
+		arrows[a.Direction] = a.Value
+	}
+	if arrows["fromPVToGrid"] != 15000 || arrows["fromPVToConsumer"] != 5000 || arrows["fromGridToConsumer"] != 0 {
+		t.Fatalf("unexpected arrows %v", arrows)
+	}
+
+	stats, err := c.GetGatewayConsumptionStatistics("sm1", solarmanager.Month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Period != "month" {
+		t.Fatalf("unexpected period %q", stats.Period)
+	}
+}
+
+func TestBatteryArrows(t *testing.T) {
+	g := NewGateway("sm1")
+	g.Production = 1000
+	g.Consumption = 3000
+	g.BatteryChargeDischarge = -1500
+	arrows := make(map[string]solarmanager.Watt)
+	for _, a := range g.pieChart(time.Now()).Arrows {
+		arrows[a.Direction] = a.Value
+	}
+	if arrows["fromPVToConsumer"] != 1000 || arrows["fromBatteryToConsumer"] != 1500 || arrows["fromGridToConsumer"] != 500 {
+		t.Fatalf("unexpected arrows %v", arrows)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	c := solarmanager.NewClient(nil, s.BaseURL(), "user", "wrong")
+	if _, err := c.GetSensors("sm1"); err == nil {
+		t.Fatal("expected error for invalid credentials")
+	}
+}
+
+func TestControlWrites(t *testing.T) {
+	s := newTestServer(t)
+	c := s.NewClient()
+
+	req, err := c.NewRequest("PUT", "v1/control/switch/sm1-heater", map[string]int{"switchState": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	writes := s.Writes()
+	if len(writes) != 1 || writes[0].SensorID != "sm1-heater" || !strings.Contains(string(writes[0].Body), "switchState") {
+		t.Fatalf("unexpected writes %+v", writes)
+	}
+	d, err := c.GetSensorData("sm1", "sm1-heater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Data.SwitchState != solarmanager.Some(1) {
+		t.Fatalf("control write not applied, switch state is %+v", d.Data.SwitchState)
+	}
+}
+
+func TestFaultsAndLatency(t *testing.T) {
+	s := newTestServer(t)
+	c := s.NewClient()
+
+	s.Fail("/v1/info/", http.StatusServiceUnavailable, 1)
+	if _, err := c.GetGatewayInfo("sm1"); err == nil {
+		t.Fatal("expected injected failure")
+	}
+	if _, err := c.GetGatewayInfo("sm1"); err != nil {
+		t.Fatalf("fault should have been used up: %v", err)
+	}
+
+	s.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := c.GetLowRateTariff("sm1"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("latency not applied")
+	}
+	if s.Requests() != 3 {
+		t.Fatalf("unexpected number of requests, expected 3, but got %d", s.Requests())
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := &Fake{
+		GetSensorDataFunc: func(solarManagerID, sensorID string) (solarmanager.GetSensorDataResponse, error) {
+			var resp solarmanager.GetSensorDataResponse
+			resp.Data.Id = sensorID
+			resp.Data.CurrentPower = solarmanager.Some[solarmanager.Watt](1200)
+			return resp, nil
+		},
+	}
+	var api solarmanager.API = f
+
+	d, err := api.GetSensorData("sm1", "dev1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Data.Id != "dev1" || d.Data.CurrentPower != solarmanager.Some[solarmanager.Watt](1200) {
+		t.Fatalf("unexpected sensor data %+v", d)
+	}
+	if _, err := api.GetGatewayConsumptionStatistics("sm1", solarmanager.Month); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := f.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("unexpected number of calls, expected 2, but got %d", len(calls))
+	}
+	expected := Call{Method: "GetGatewayConsumptionStatistics", Args: []interface{}{"sm1", solarmanager.StatisticPeriod(solarmanager.Month)}}
+	if !reflect.DeepEqual(calls[1], expected) {
+		t.Fatalf("unexpected call %+v", calls[1])
+	}
+	if len(f.CallsTo("GetSensorData")) != 1 {
+		t.Fatalf("unexpected calls to GetSensorData %+v", f.CallsTo("GetSensorData"))
+	}
+	f.Reset()
+	if len(f.Calls()) != 0 {
+		t.Fatal("calls not reset")
+	}
+}
+
+func TestFakeContext(t *testing.T) {
+	f := &Fake{
+		GetGatewayDataFunc: func(solarManagerID string) (solarmanager.GetGatewayDataResponse, error) {
+			return solarmanager.GetGatewayDataResponse{CurrentPvGeneration: 1000}, nil
+		},
+	}
+	var api solarmanager.API = f
+	d, err := api.GetGatewayDataContext(context.Background(), "sm1")
+	if err != nil || d.CurrentPvGeneration != 1000 {
+		t.Fatalf("unexpected gateway data %+v, %v", d, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := api.GetAllSensorData(ctx, "sm1", 2); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+	expected := []Call{
+		{Method: "GetGatewayDataContext", Args: []interface{}{"sm1"}},
+		{Method: "GetAllSensorData", Args: []interface{}{"sm1", 2}},
+	}
+	if calls := f.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
+
+func TestFakeListGateways(t *testing.T) {
+	f := &Fake{
+		ListGatewaysFunc: func(page, pageSize int) ([]solarmanager.GatewayInfo, error) {
+			if page > 1 {
+				return nil, nil
+			}
+			return []solarmanager.GatewayInfo{{SmId: "sm1"}, {SmId: "sm2"}}, nil
+		},
+	}
+	var api solarmanager.API = f
+	gateways, err := api.ListGateways(context.Background(), &solarmanager.ListOptions{PageSize: 2}).All()
+	if err != nil || len(gateways) != 2 || gateways[1].SmId != "sm2" {
+		t.Fatalf("unexpected gateways %+v, %v", gateways, err)
+	}
+	expected := []Call{
+		{Method: "ListGateways", Args: []interface{}{1, 2}},
+		{Method: "ListGateways", Args: []interface{}{2, 2}},
+	}
+	if calls := f.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
+
+func TestListGateways(t *testing.T) {
+	s := NewServer("installer", "secret")
+	defer s.Close()
+	for _, id := range []string{"sm3", "sm1", "sm5", "sm2", "sm4"} {
+		s.AddGateway(NewGateway(id))
+	}
+	c := s.NewClient()
+
+	it := c.ListGateways(context.Background(), &solarmanager.ListOptions{PageSize: 2})
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Value().SmId)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "sm1,sm2,sm3,sm4,sm5" {
+		t.Fatalf("unexpected gateways %v", ids)
+	}
+	if n := s.Requests(); n != 3 {
+		t.Fatalf("expected 3 page requests, got %d", n)
+	}
+
+	users, err := c.ListUsers(context.Background(), nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 5 || users[0].UserId != "user-sm1" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+}
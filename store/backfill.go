@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+// StatisticsSource provides the statistics used by Backfill. It is
+// implemented by *solarmanager.Client.
+type StatisticsSource interface {
+	GetSensors(solarManagerID string) (solarmanager.GetSensorsResponse, error)
+	GetGatewayConsumptionStatistics(solarManagerID string, period solarmanager.StatisticPeriod) (solarmanager.GetGatewayConsumptionStatisticsResponse, error)
+	GetSensorConsumptionStatistics(sensorID string, period solarmanager.StatisticPeriod) (solarmanager.GetSensorConsumptionStatisticsResponse, error)
+}
+
+// Backfill fetches the gateway and per-sensor consumption statistics of every
+// given period and stores them. If no periods are given, day, month and year
+// statistics are fetched. As stores are upserts, Backfill can be run
+// repeatedly to extend the local history.
+func (s *Store) Backfill(ctx context.Context, src StatisticsSource, solarManagerID string, periods ...solarmanager.StatisticPeriod) error {
+	if len(periods) == 0 {
+		periods = []solarmanager.StatisticPeriod{solarmanager.Day, solarmanager.Month, solarmanager.Year}
+	}
+
+	sensors, err := src.GetSensors(solarManagerID)
+	if err != nil {
+		return fmt.Errorf("store: fetching sensors: %w", err)
+	}
+
+	for _, period := range periods {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		gw, err := src.GetGatewayConsumptionStatistics(solarManagerID, period)
+		if err != nil {
+			return fmt.Errorf("store: fetching %s gateway statistics: %w", period, err)
+		}
+		if gw.Period == "" {
+			gw.Period = string(period)
+		}
+		if err := s.SaveGatewayConsumption(ctx, solarManagerID, gw); err != nil {
+			return err
+		}
+
+		for _, sensor := range sensors {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			st, err := src.GetSensorConsumptionStatistics(sensor.Id, period)
+			if err != nil {
+				return fmt.Errorf("store: fetching %s statistics of sensor %s: %w", period, sensor.Id, err)
+			}
+			if st.SensorId == "" {
+				st.SensorId = sensor.Id
+			}
+			if st.Period == "" {
+				st.Period = string(period)
+			}
+			if err := s.SaveSensorConsumption(ctx, solarManagerID, st); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package store keeps a local history of SolarManager data in SQLite, so that
+// it outlives the limited history windows of the cloud API.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+	_ "modernc.org/sqlite" // pure Go SQLite driver
+)
+
+// migrations are applied in order. The number of applied migrations is kept
+// in the database's user_version pragma, so existing entries must never be
+// modified; append new ones instead.
+var migrations = []string{
+	`CREATE TABLE gateway_snapshots (
+		sm_id TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (sm_id, timestamp)
+	);
+	CREATE TABLE sensor_readings (
+		sm_id TEXT NOT NULL,
+		sensor_id TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (sm_id, sensor_id, timestamp)
+	);
+	CREATE TABLE consumption (
+		sm_id TEXT NOT NULL,
+		sensor_id TEXT NOT NULL,
+		period TEXT NOT NULL,
+		date TEXT NOT NULL,
+		consumption REAL NOT NULL,
+		production REAL NOT NULL,
+		PRIMARY KEY (sm_id, sensor_id, period, date)
+	);`,
+}
+
+// Store persists gateway snapshots, sensor readings and consumption buckets.
+// Writes are idempotent upserts keyed on SolarManager ID, sensor ID and
+// timestamp, so the same data can safely be stored more than once.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens or creates the SQLite database at path and migrates it to the
+// latest schema. Use ":memory:" for a transient database.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer only and every connection to ":memory:"
+	// would open a separate database.
+	db.SetMaxOpenConns(1)
+	s, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New returns a Store using an already opened SQLite database and migrates it
+// to the latest schema.
+func New(db *sql.DB) (*Store, error) {
+	s := &Store{db: db}
+	if err := s.migrate(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	var version int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: migration %d failed: %w", version+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveGatewayData stores a live gateway snapshot.
+func (s *Store) SaveGatewayData(ctx context.Context, solarManagerID string, d solarmanager.GetGatewayDataResponse) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO gateway_snapshots (sm_id, timestamp, data) VALUES (?, ?, ?)
+		ON CONFLICT (sm_id, timestamp) DO UPDATE SET data = excluded.data`,
+		solarManagerID, d.TimeStamp.UnixMilli(), string(data))
+	return err
+}
+
+// SaveSensorData stores a live sensor reading.
+func (s *Store) SaveSensorData(ctx context.Context, solarManagerID string, d solarmanager.GetSensorDataResponse) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO sensor_readings (sm_id, sensor_id, timestamp, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (sm_id, sensor_id, timestamp) DO UPDATE SET data = excluded.data`,
+		solarManagerID, d.Data.Id, d.Date.UnixMilli(), string(data))
+	return err
+}
+
+func (s *Store) saveConsumption(ctx context.Context, solarManagerID, sensorID, period string, rows func(stmt *sql.Stmt) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO consumption (sm_id, sensor_id, period, date, consumption, production) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (sm_id, sensor_id, period, date) DO UPDATE SET consumption = excluded.consumption, production = excluded.production`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	if err := rows(stmt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveGatewayConsumption stores the buckets of gateway consumption statistics.
+func (s *Store) SaveGatewayConsumption(ctx context.Context, solarManagerID string, st solarmanager.GetGatewayConsumptionStatisticsResponse) error {
+	return s.saveConsumption(ctx, solarManagerID, "", st.Period, func(stmt *sql.Stmt) error {
+		for _, d := range st.Data {
+			if _, err := stmt.ExecContext(ctx, solarManagerID, "", st.Period, d.CreatedAt, d.Consumption, d.Production); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SaveSensorConsumption stores the buckets of sensor consumption statistics.
+func (s *Store) SaveSensorConsumption(ctx context.Context, solarManagerID string, st solarmanager.GetSensorConsumptionStatisticsResponse) error {
+	return s.saveConsumption(ctx, solarManagerID, st.SensorId, st.Period, func(stmt *sql.Stmt) error {
+		for _, d := range st.Data {
+			if _, err := stmt.ExecContext(ctx, solarManagerID, st.SensorId, st.Period, d.CreatedAt, d.Consumption, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GatewaySnapshots returns the gateway snapshots with from <= TimeStamp < to,
+// ordered by time.
+func (s *Store) GatewaySnapshots(ctx context.Context, solarManagerID string, from, to time.Time) ([]solarmanager.GetGatewayDataResponse, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM gateway_snapshots
+		WHERE sm_id = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp`,
+		solarManagerID, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []solarmanager.GetGatewayDataResponse
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var d solarmanager.GetGatewayDataResponse
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, d)
+	}
+	return snapshots, rows.Err()
+}
+
+// SensorReadings returns the readings of a sensor with from <= Date < to,
+// ordered by time.
+func (s *Store) SensorReadings(ctx context.Context, solarManagerID, sensorID string, from, to time.Time) ([]solarmanager.GetSensorDataResponse, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM sensor_readings
+		WHERE sm_id = ? AND sensor_id = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp`,
+		solarManagerID, sensorID, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []solarmanager.GetSensorDataResponse
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var d solarmanager.GetSensorDataResponse
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			return nil, err
+		}
+		readings = append(readings, d)
+	}
+	return readings, rows.Err()
+}
+
+// GatewayConsumption returns the stored gateway consumption buckets of the
+// given period with from <= date < to. Dates are compared as strings in the
+// format returned by the API, e.g. "2021-04-13".
+func (s *Store) GatewayConsumption(ctx context.Context, solarManagerID string, period solarmanager.StatisticPeriod, from, to string) (solarmanager.GetGatewayConsumptionStatisticsResponse, error) {
+	response := solarmanager.GetGatewayConsumptionStatisticsResponse{Period: string(period)}
+	rows, err := s.db.QueryContext(ctx, `SELECT date, consumption, production FROM consumption
+		WHERE sm_id = ? AND sensor_id = '' AND period = ? AND date >= ? AND date < ? ORDER BY date`,
+		solarManagerID, string(period), from, to)
+	if err != nil {
+		return response, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d solarmanager.GatewayConsumption
+		if err := rows.Scan(&d.CreatedAt, &d.Consumption, &d.Production); err != nil {
+			return response, err
+		}
+		response.Data = append(response.Data, d)
+		response.TotalConsumption += d.Consumption
+	}
+	return response, rows.Err()
+}
+
+// SensorConsumption returns the stored sensor consumption buckets of the
+// given period with from <= date < to.
+func (s *Store) SensorConsumption(ctx context.Context, solarManagerID, sensorID string, period solarmanager.StatisticPeriod, from, to string) (solarmanager.GetSensorConsumptionStatisticsResponse, error) {
+	response := solarmanager.GetSensorConsumptionStatisticsResponse{SensorId: sensorID, Period: string(period)}
+	rows, err := s.db.QueryContext(ctx, `SELECT date, consumption FROM consumption
+		WHERE sm_id = ? AND sensor_id = ? AND period = ? AND date >= ? AND date < ? ORDER BY date`,
+		solarManagerID, sensorID, string(period), from, to)
+	if err != nil {
+		return response, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d solarmanager.SensorConsumption
+		if err := rows.Scan(&d.CreatedAt, &d.Consumption); err != nil {
+			return response, err
+		}
+		response.Data = append(response.Data, d)
+		response.TotalConsumption += d.Consumption
+	}
+	return response, rows.Err()
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ingmarstein/solarmanager-go/solarmanager"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	for i := 0; i < 2; i++ {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var version int
+		if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != len(migrations) {
+			t.Fatalf("unexpected schema version, expected %d, but got %d", len(migrations), version)
+		}
+		s.Close()
+	}
+}
+
+func TestGatewaySnapshots(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ts := time.Date(2021, 2, 1, 16, 9, 39, 744000000, time.UTC)
+
+	d := solarmanager.GetGatewayDataResponse{
+		TimeStamp:               ts,
+		CurrentPowerConsumption: 494,
+		Devices:                 []solarmanager.SensorData{{Id: "dev1", CurrentPower: solarmanager.Some[solarmanager.Watt](1200)}},
+	}
+	if err := s.SaveGatewayData(ctx, "sm1", d); err != nil {
+		t.Fatal(err)
+	}
+	// Storing the same timestamp again must update, not duplicate.
+	d.CurrentPowerConsumption = 500
+	if err := s.SaveGatewayData(ctx, "sm1", d); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveGatewayData(ctx, "sm2", d); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := s.GatewaySnapshots(ctx, "sm1", ts.Add(-time.Minute), ts.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("unexpected number of snapshots, expected 1, but got %d", len(snapshots))
+	}
+	if snapshots[0].CurrentPowerConsumption != 500 || !snapshots[0].TimeStamp.Equal(ts) {
+		t.Fatalf("unexpected snapshot %+v", snapshots[0])
+	}
+	if p := snapshots[0].Devices[0].CurrentPower; p != solarmanager.Some[solarmanager.Watt](1200) {
+		t.Fatalf("unexpected device power, expected 1200, but got %+v", p)
+	}
+}
+
+func TestSensorReadings(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ts := time.Date(2021, 3, 25, 9, 26, 37, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		var d solarmanager.GetSensorDataResponse
+		d.Date = ts.Add(time.Duration(i) * time.Minute)
+		d.Data.Id = "dev1"
+		d.Data.CurrentWaterTemp = solarmanager.Some(26 + i)
+		if err := s.SaveSensorData(ctx, "sm1", d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readings, err := s.SensorReadings(ctx, "sm1", "dev1", ts.Add(time.Minute), ts.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readings) != 2 || readings[0].Data.CurrentWaterTemp.Value != 27 || readings[1].Data.CurrentWaterTemp.Value != 28 {
+		t.Fatalf("unexpected readings %+v", readings)
+	}
+}
+
+type fakeSource struct{}
+
+func (fakeSource) GetSensors(string) (solarmanager.GetSensorsResponse, error) {
+	return solarmanager.GetSensorsResponse{{Id: "dev1"}}, nil
+}
+
+func (fakeSource) GetGatewayConsumptionStatistics(_ string, period solarmanager.StatisticPeriod) (solarmanager.GetGatewayConsumptionStatisticsResponse, error) {
+	var response solarmanager.GetGatewayConsumptionStatisticsResponse
+	err := json.Unmarshal([]byte(`{"period": "`+string(period)+`", "data": [
+		{"createdAt": "2021-04-13", "consumption": 1000, "production": 3000},
+		{"createdAt": "2021-04-14", "consumption": 500, "production": 0}
+	]}`), &response)
+	return response, err
+}
+
+func (fakeSource) GetSensorConsumptionStatistics(sensorID string, period solarmanager.StatisticPeriod) (solarmanager.GetSensorConsumptionStatisticsResponse, error) {
+	var response solarmanager.GetSensorConsumptionStatisticsResponse
+	err := json.Unmarshal([]byte(`{"data": [{"createdAt": "2021-04-13", "consumption": 120.5}]}`), &response)
+	return response, err
+}
+
+func TestBackfill(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := s.Backfill(ctx, fakeSource{}, "sm1", solarmanager.Day); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gw, err := s.GatewayConsumption(ctx, "sm1", solarmanager.Day, "2021-04-01", "2021-05-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gw.Data) != 2 || gw.TotalConsumption != 1500 || gw.Data[0].Production != 3000 {
+		t.Fatalf("unexpected gateway consumption %+v", gw)
+	}
+
+	st, err := s.SensorConsumption(ctx, "sm1", "dev1", solarmanager.Day, "2021-04-01", "2021-05-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Data) != 1 || st.Data[0].Consumption != 120.5 || st.SensorId != "dev1" {
+		t.Fatalf("unexpected sensor consumption %+v", st)
+	}
+
+	month, err := s.GatewayConsumption(ctx, "sm1", solarmanager.Month, "2021-04-01", "2021-05-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(month.Data) != 0 {
+		t.Fatalf("unexpected monthly buckets %+v", month.Data)
+	}
+}